@@ -0,0 +1,3 @@
+module github.com/felixge/go-profiler-notes/bench
+
+go 1.16
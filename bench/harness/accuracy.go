@@ -0,0 +1,225 @@
+package harness
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// workloadFrame is the name of the function found in the stack traces of all
+// blocking operations performed by workloads, unless they implement
+// ProfileFramer. It's used to ignore other blocking events, e.g. the worker
+// waiting for the workload goroutines to finish. The package path is not
+// included, so it also matches in tests.
+const workloadFrame = "AtStackDepth"
+
+// ProfileAccuracy compares the values reported by a profile with the ground
+// truth known by the workload.
+type ProfileAccuracy struct {
+	// Samples is the number of samples attributed to the workload.
+	Samples int
+	// ContentionsRatio is the number of contentions reported by the profile
+	// divided by the number of operations performed.
+	ContentionsRatio float64
+	// DelayRatio is the delay reported by the profile divided by the wait
+	// time measured by the workload.
+	DelayRatio float64
+	// Stacks holds the accuracy of every stack attributed to the workload,
+	// ordered by the number of contentions, highest first.
+	Stacks []StackAccuracy
+}
+
+// StackAccuracy compares the values reported for a single stack with the
+// ground truth known by the workload. Workloads that block in more than one
+// place per operation, e.g. the sender and receiver of a channel, report one
+// stack per place, so the ratios of a single stack can't be expected to add
+// up to 1.
+type StackAccuracy struct {
+	// Stack holds the function names of the stack, leaf first.
+	Stack []string
+	// Samples is the number of samples with this stack.
+	Samples int
+	// Contentions is the number of contentions reported for the stack.
+	Contentions int64
+	// Delay is the delay reported for the stack.
+	Delay time.Duration
+	// ContentionsRatio is Contentions divided by the number of operations
+	// performed.
+	ContentionsRatio float64
+	// DelayRatio is Delay divided by the wait time measured by the workload.
+	DelayRatio float64
+}
+
+// blockProfileAccuracy returns the accuracy of the block profile p for the
+// workload that produced result, in total and for every stack. The ground
+// truth is the number of operations and the sum of their latencies, so the
+// ratios are expected to be below 1 for workloads that perform non-blocking
+// operations, e.g. uncontended Lock calls. Only samples with frame in their
+// stack are attributed to the workload, or all of them if frame is "". The
+// latencies are extrapolated if only every latencySample-th operation was
+// recorded, and the delay ratios are NaN if none were.
+func blockProfileAccuracy(p *profile, result *WorkloadResult, frame string, latencySample int) (*ProfileAccuracy, error) {
+	contentionsIdx, delayIdx := -1, -1
+	for i, st := range p.SampleTypes {
+		switch st {
+		case "contentions/count":
+			contentionsIdx = i
+		case "delay/nanoseconds":
+			delayIdx = i
+		}
+	}
+	if contentionsIdx == -1 || delayIdx == -1 {
+		return nil, fmt.Errorf("not a block profile: sample types: %v", p.SampleTypes)
+	}
+
+	acc := &ProfileAccuracy{}
+	stacks := map[string]int{}
+	var contentions, delay int64
+	for _, s := range p.Samples {
+		if frame != "" && !inStack(s.Stack, frame) {
+			continue
+		}
+		acc.Samples++
+		contentions += s.Values[contentionsIdx]
+		delay += s.Values[delayIdx]
+
+		key := strings.Join(s.Stack, "\n")
+		i, ok := stacks[key]
+		if !ok {
+			i = len(acc.Stacks)
+			stacks[key] = i
+			acc.Stacks = append(acc.Stacks, StackAccuracy{Stack: s.Stack})
+		}
+		st := &acc.Stacks[i]
+		st.Samples++
+		st.Contentions += s.Values[contentionsIdx]
+		st.Delay += time.Duration(s.Values[delayIdx])
+	}
+
+	var wait time.Duration
+	if result.Latencies != nil {
+		wait = result.Latencies.Sum() * time.Duration(latencySample)
+	}
+	ratio := func(value, truth int64) float64 {
+		if truth <= 0 {
+			return math.NaN()
+		}
+		return float64(value) / float64(truth)
+	}
+	acc.ContentionsRatio = ratio(contentions, result.Ops)
+	acc.DelayRatio = ratio(delay, int64(wait))
+	for i := range acc.Stacks {
+		st := &acc.Stacks[i]
+		st.ContentionsRatio = ratio(st.Contentions, result.Ops)
+		st.DelayRatio = ratio(int64(st.Delay), int64(wait))
+	}
+	sort.SliceStable(acc.Stacks, func(i, j int) bool {
+		return acc.Stacks[i].Contentions > acc.Stacks[j].Contentions
+	})
+	return acc, nil
+}
+
+// WriteStacks writes the accuracy of every stack to w, one line per stack
+// followed by its indented function names.
+func (a *ProfileAccuracy) WriteStacks(w io.Writer) error {
+	for _, st := range a.Stacks {
+		if _, err := fmt.Fprintf(w, "samples=%d contentions=%d delay=%s contentions_ratio=%.3f delay_ratio=%.3f\n",
+			st.Samples, st.Contentions, st.Delay, st.ContentionsRatio, st.DelayRatio); err != nil {
+			return err
+		}
+		for _, fn := range st.Stack {
+			if _, err := fmt.Fprintf(w, "\t%s\n", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// contentionsRatioRange returns the lowest and highest ContentionsRatio of
+// the stacks, or NaN if there are none.
+func (a *ProfileAccuracy) contentionsRatioRange() (min, max float64) {
+	min, max = math.NaN(), math.NaN()
+	for i, st := range a.Stacks {
+		if i == 0 || st.ContentionsRatio < min {
+			min = st.ContentionsRatio
+		}
+		if i == 0 || st.ContentionsRatio > max {
+			max = st.ContentionsRatio
+		}
+	}
+	return min, max
+}
+
+// inStack returns true if stack contains a function with the given name,
+// ignoring the package path.
+func inStack(stack []string, name string) bool {
+	for _, frame := range stack {
+		if strings.HasSuffix(frame, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CPUProfileStats summarizes the samples of a cpu profile.
+type CPUProfileStats struct {
+	// Samples is the number of samples captured by the profiler.
+	Samples int64
+	// Lost is the number of samples the runtime knows it failed to capture,
+	// e.g. because its buffer was full or the signal arrived at a bad time.
+	// Samples dropped by the kernel, e.g. because a signal was coalesced, are
+	// not included.
+	Lost int64
+	// SamplesRatio is Samples divided by the number of samples expected for
+	// the cpu time consumed while profiling, or NaN if it's unknown. Unlike
+	// Lost, it accounts for samples the runtime never learned about.
+	SamplesRatio float64
+}
+
+// lostSampleFrames are the pseudo functions the runtime uses as the stack
+// of cpu profile samples that couldn't be captured.
+var lostSampleFrames = []string{
+	"_LostExternalCode",
+	"_LostSIGPROFDuringAtomic64",
+	"_LostContendedRuntimeLock",
+	"lostProfileEvent",
+}
+
+// cpuProfileSamples returns the number of captured and lost samples of the
+// cpu profile p, which was recorded at the given rate in Hz while the process
+// consumed cpuTime, or 0 if that's unknown.
+func cpuProfileSamples(p *profile, rate int, cpuTime time.Duration) (*CPUProfileStats, error) {
+	samplesIdx := -1
+	for i, st := range p.SampleTypes {
+		if st == "samples/count" {
+			samplesIdx = i
+		}
+	}
+	if samplesIdx == -1 {
+		return nil, fmt.Errorf("not a cpu profile: sample types: %v", p.SampleTypes)
+	}
+
+	stats := &CPUProfileStats{SamplesRatio: math.NaN()}
+	for _, s := range p.Samples {
+		lost := false
+		for _, name := range lostSampleFrames {
+			if inStack(s.Stack, name) {
+				lost = true
+				break
+			}
+		}
+		if lost {
+			stats.Lost += s.Values[samplesIdx]
+		} else {
+			stats.Samples += s.Values[samplesIdx]
+		}
+	}
+	if expected := cpuTime.Seconds() * float64(rate); expected > 0 {
+		stats.SamplesRatio = float64(stats.Samples) / expected
+	}
+	return stats, nil
+}
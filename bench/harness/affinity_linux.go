@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package harness
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// pinCPUs restricts all threads of the current process to the given cpus.
+// Threads created afterwards inherit the affinity of the thread creating them.
+func pinCPUs(cpus []int) error {
+	var mask [1024 / 64]uint64
+	for _, cpu := range cpus {
+		if cpu < 0 || cpu >= len(mask)*64 {
+			return fmt.Errorf("bad cpu: %d", cpu)
+		}
+		mask[cpu/64] |= 1 << (cpu % 64)
+	}
+
+	// Keep going until no new threads show up, as the runtime might spawn
+	// new threads from unpinned ones while we are iterating.
+	pinned := map[int]bool{}
+	for {
+		entries, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		var found bool
+		for _, entry := range entries {
+			tid, err := strconv.Atoi(entry.Name())
+			if err != nil || pinned[tid] {
+				continue
+			}
+			_, _, errno := syscall.RawSyscall(
+				syscall.SYS_SCHED_SETAFFINITY,
+				uintptr(tid),
+				uintptr(len(mask)*8),
+				uintptr(unsafe.Pointer(&mask[0])),
+			)
+			if errno != 0 && errno != syscall.ESRCH {
+				return fmt.Errorf("sched_setaffinity: thread %d: %w", tid, errno)
+			}
+			pinned[tid] = true
+			found = true
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+// allowedCPUs returns the cpus in the affinity mask of the current process,
+// which might be a subset of 0..runtime.NumCPU()-1 when running under
+// taskset, cgroup cpusets or in a container.
+func allowedCPUs() ([]int, error) {
+	var mask [1024 / 64]uint64
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_SCHED_GETAFFINITY,
+		0,
+		uintptr(len(mask)*8),
+		uintptr(unsafe.Pointer(&mask[0])),
+	)
+	if errno != 0 {
+		return nil, fmt.Errorf("sched_getaffinity: %w", errno)
+	}
+	var cpus []int
+	for cpu := 0; cpu < len(mask)*64; cpu++ {
+		if mask[cpu/64]&(1<<(cpu%64)) != 0 {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
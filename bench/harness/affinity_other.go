@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package harness
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// pinCPUs is only supported on linux.
+func pinCPUs(cpus []int) error {
+	return fmt.Errorf("cpu pinning is not supported on %s", runtime.GOOS)
+}
+
+// allowedCPUs is only supported on linux.
+func allowedCPUs() ([]int, error) {
+	return nil, fmt.Errorf("cpu pinning is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package harness
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// processCPUTime is not supported on this platform.
+func processCPUTime() (time.Duration, error) {
+	return 0, fmt.Errorf("cpu time is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,53 @@
+package harness
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// csvWriter writes rows as CSV, starting with the environment header, if any,
+// and a header row. The environment header is not part of the CSV format, so
+// it's only written if the user asked for it.
+type csvWriter struct {
+	cw *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, env Environment) (*csvWriter, error) {
+	if err := writeEnvHeader(w, env); err != nil {
+		return nil, err
+	}
+	c := &csvWriter{cw: csv.NewWriter(w)}
+	c.cw.Write(Headers())
+	c.cw.Flush()
+	return c, c.cw.Error()
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	c.cw.Write(formatCSVRow(values))
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func formatCSVRow(values []interface{}) []string {
+	row := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			row[i] = v
+		case int64:
+			row[i] = fmt.Sprintf("%d", v)
+		case float64:
+			row[i] = fmt.Sprintf("%f", v)
+		default:
+			row[i] = fmt.Sprintf("%v", v)
+		}
+	}
+	return row
+}
@@ -0,0 +1,183 @@
+package harness
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// EnvVar is a single entry of an environment fingerprint.
+type EnvVar struct {
+	Key   string
+	Value string
+}
+
+// Environment is a fingerprint of the machine and Go runtime that produced a
+// result set. Results from different environments are not comparable, so the
+// leader embeds it into its output and summarize refuses to mix them.
+type Environment []EnvVar
+
+// CollectEnvironment returns the fingerprint of the current environment.
+// Values that can't be determined on the current platform are reported as
+// "unknown".
+func CollectEnvironment() Environment {
+	return Environment{
+		{"go_version", runtime.Version()},
+		{"goos", runtime.GOOS},
+		{"goarch", runtime.GOARCH},
+		{"num_cpu", strconv.Itoa(runtime.NumCPU())},
+		{"gomaxprocs", strconv.Itoa(runtime.GOMAXPROCS(0))},
+		{"cpu_model", cpuModel()},
+		{"kernel", readSysFile("/proc/sys/kernel/osrelease")},
+		{"cgroup_cpu_quota", cgroupCPUQuota()},
+		{"cpu_governor", readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor")},
+		{"cpu_boost", cpuBoost()},
+	}
+}
+
+// Get returns the value for key, or "" if there is no such key.
+func (e Environment) Get(key string) string {
+	for _, v := range e {
+		if v.Key == key {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// Set replaces the value of key, or adds it if there is no such key.
+func (e *Environment) Set(key, value string) {
+	for i, v := range *e {
+		if v.Key == key {
+			(*e)[i].Value = value
+			return
+		}
+	}
+	*e = append(*e, EnvVar{key, value})
+}
+
+// Diff returns a description of every key whose value differs between e and
+// other.
+func (e Environment) Diff(other Environment) []string {
+	var diffs []string
+	seen := map[string]bool{}
+	for _, list := range []Environment{e, other} {
+		for _, v := range list {
+			if seen[v.Key] {
+				continue
+			}
+			seen[v.Key] = true
+			if a, b := e.Get(v.Key), other.Get(v.Key); a != b {
+				diffs = append(diffs, fmt.Sprintf("%s: %q vs %q", v.Key, a, b))
+			}
+		}
+	}
+	return diffs
+}
+
+// envHeaderPrefix starts every line of the environment header in CSV files.
+const envHeaderPrefix = "# "
+
+// writeEnvHeader writes e as comment lines of the form "# key: value".
+func writeEnvHeader(w io.Writer, e Environment) error {
+	for _, v := range e {
+		if _, err := fmt.Fprintf(w, "%s%s: %s\n", envHeaderPrefix, v.Key, v.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEnvHeader consumes the environment header written by writeEnvHeader
+// from r, if any.
+func readEnvHeader(r *bufio.Reader) (Environment, error) {
+	var e Environment
+	for {
+		peek, err := r.Peek(len(envHeaderPrefix))
+		if err != nil || string(peek) != envHeaderPrefix {
+			return e, nil
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSuffix(strings.TrimPrefix(line, envHeaderPrefix), "\n")
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad environment header: %q", line)
+		}
+		e = append(e, EnvVar{kv[0], kv[1]})
+	}
+}
+
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return "unknown"
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "model name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return "unknown"
+}
+
+// cgroupCPUQuota returns the cpu quota of the cgroup as "<quota>/<period>" in
+// microseconds, or "max" if there is no limit. Both cgroup v2 and v1 are
+// supported.
+func cgroupCPUQuota() string {
+	if data, err := ioutil.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 {
+			if fields[0] == "max" {
+				return "max"
+			}
+			return fields[0] + "/" + fields[1]
+		}
+	}
+	quota := readSysFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	period := readSysFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if quota == "unknown" || period == "unknown" {
+		return "unknown"
+	} else if quota == "-1" {
+		return "max"
+	}
+	return quota + "/" + period
+}
+
+// cpuBoost returns "on" or "off" depending on whether the cpu is allowed to
+// exceed its base frequency (turbo boost).
+func cpuBoost() string {
+	switch readSysFile("/sys/devices/system/cpu/intel_pstate/no_turbo") {
+	case "0":
+		return "on"
+	case "1":
+		return "off"
+	}
+	switch readSysFile("/sys/devices/system/cpu/cpufreq/boost") {
+	case "1":
+		return "on"
+	case "0":
+		return "off"
+	}
+	return "unknown"
+}
+
+// readSysFile returns the trimmed contents of the file at path, or "unknown"
+// if it can't be read.
+func readSysFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,305 @@
+package harness
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func gate(args []string) error {
+	fs := flag.NewFlagSet("gate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s gate [flags] -budget <budget.txt> <results.csv>\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Fails if the overhead of any configuration significantly exceeds its budget.\n\n")
+		fs.PrintDefaults()
+	}
+	var (
+		budgetPath = fs.String("budget", "", "Path to the budget file.")
+		metric     = fs.String("metric", "", "The metric column used by budgets that don't specify one. Defaults to ops_per_sec if any workload ran for a -duration, ms otherwise.")
+		alpha      = fs.Float64("alpha", 0.05, "The significance level for considering an overhead to exceed its budget.")
+	)
+	fs.Parse(args)
+
+	if *budgetPath == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("gate: expected -budget and 1 file")
+	}
+	budgets, err := readBudgets(*budgetPath)
+	if err != nil {
+		return err
+	}
+	rs, err := readResultSet(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *metric == "" {
+		*metric = rs.defaultMetric()
+	}
+	results, err := checkBudgets(rs, budgets, *metric, *alpha)
+	if err != nil {
+		return err
+	}
+	if err := printGateResults(os.Stdout, results); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("gate: %d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// budget limits the overhead of all configurations matching its params. It
+// is written as a line like:
+//
+//	mutex, depth=16, blockprofilerate=10000: max 5% overhead
+//
+// A bare word selects a workload. The metric defaults to the -metric flag,
+// but can be given explicitly, e.g. "max 10% p99_ns overhead".
+type budget struct {
+	// Line is the line of the budget file.
+	Line string
+	// Params maps column names to the required value.
+	Params map[string]string
+	// Metric is the metric column, or "" for the default.
+	Metric string
+	// MaxOverhead is the maximum overhead in percent.
+	MaxOverhead float64
+}
+
+var budgetLimitRe = regexp.MustCompile(`^max\s+([0-9.]+)%\s*(\w+)?\s+overhead$`)
+
+func readBudgets(path string) ([]*budget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	budgets, err := parseBudgets(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return budgets, nil
+}
+
+// parseBudgets parses a budget file. Empty lines and lines starting with "#"
+// are ignored.
+func parseBudgets(r io.Reader) ([]*budget, error) {
+	var budgets []*budget
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b, err := parseBudget(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, scanner.Err()
+}
+
+func parseBudget(line string) (*budget, error) {
+	i := strings.LastIndex(line, ":")
+	if i == -1 {
+		return nil, fmt.Errorf("bad budget: %q: missing \":\"", line)
+	}
+	selector, limit := line[:i], strings.TrimSpace(line[i+1:])
+
+	m := budgetLimitRe.FindStringSubmatch(limit)
+	if m == nil {
+		return nil, fmt.Errorf("bad limit: %q: must look like \"max 5%% overhead\"", limit)
+	}
+	b := &budget{Line: line, Params: map[string]string{}, Metric: m[2]}
+	var err error
+	if b.MaxOverhead, err = strconv.ParseFloat(m[1], 64); err != nil {
+		return nil, fmt.Errorf("bad limit: %q: %w", limit, err)
+	}
+
+	for _, field := range strings.Split(selector, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 1 {
+			kv = []string{"workload", kv[0]}
+		}
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if ColumnKindOf(key) != ParamColumn {
+			return nil, fmt.Errorf("bad selector: %q: %s is not a parameter", field, key)
+		}
+		b.Params[key] = val
+	}
+	return b, nil
+}
+
+// gateResult is the outcome of checking a single configuration against a
+// budget.
+type gateResult struct {
+	Budget *budget
+	Metric string
+	// Config describes the configuration, or is empty if the budget didn't
+	// match any configuration.
+	Config string
+	// Overhead is the measured overhead in percent.
+	Overhead float64
+	// P is the p-value of a one-sided Mann-Whitney U test for the runs being
+	// worse than the baseline runs scaled by the budget, i.e. greater or, for
+	// metrics in higherIsBetter, smaller.
+	P float64
+	// Exceeded is true if the mean overhead is larger than the budget, which
+	// causes the check to fail if the difference is significant.
+	Exceeded    bool
+	Significant bool
+	// Err describes why the configuration couldn't be checked.
+	Err string
+}
+
+// Failed returns true if the check failed.
+func (r *gateResult) Failed() bool {
+	return r.Err != "" || (r.Exceeded && r.Significant)
+}
+
+// checkBudgets compares the overhead of every configuration in rs matching
+// a budget with its limit. To avoid failing on noise, an overhead is only
+// considered to exceed its budget if the runs of the configuration are
+// significantly slower than the runs of the baseline with the budget added,
+// according to a one-sided Mann-Whitney U test. Configurations with too few
+// runs for the test to ever reach alpha fail, as they couldn't fail otherwise.
+func checkBudgets(rs *resultSet, budgets []*budget, defaultMetric string, alpha float64) ([]*gateResult, error) {
+	paramIdx := map[string]int{}
+	for i, name := range rs.Params {
+		paramIdx[name] = i
+	}
+
+	var results []*gateResult
+	for _, b := range budgets {
+		metric := b.Metric
+		if metric == "" {
+			metric = defaultMetric
+		}
+		for name := range b.Params {
+			if _, ok := paramIdx[name]; !ok {
+				return nil, fmt.Errorf("budget %q: unknown column: %s", b.Line, name)
+			}
+		}
+
+		var matched int
+		for _, g := range rs.Groups {
+			base := rs.baseline(g)
+			if !matchesBudget(g, b, paramIdx) || base == g {
+				continue
+			}
+			matched++
+			r := &gateResult{Budget: b, Metric: metric, Config: describeGroup(rs, g, b)}
+			results = append(results, r)
+
+			vals := g.Metrics[metric]
+			if base == nil {
+				r.Err = "no baseline"
+				continue
+			} else if len(vals) == 0 || len(base.Metrics[metric]) == 0 {
+				r.Err = "no " + metric + " values"
+				continue
+			}
+
+			r.Overhead = overhead(metric, vals, base.Metrics[metric])
+			r.Exceeded = r.Overhead > b.MaxOverhead
+			scale := 1 + b.MaxOverhead/100
+			if higherIsBetter[metric] {
+				scale = 1 - b.MaxOverhead/100
+			}
+			limit := make([]float64, len(base.Metrics[metric]))
+			for i, v := range base.Metrics[metric] {
+				limit[i] = v * scale
+			}
+			if minP := mannWhitneyMinP(len(vals), len(limit)); minP > alpha {
+				r.Err = fmt.Sprintf("too few runs: p >= %.3f > alpha", minP)
+				continue
+			}
+			if higherIsBetter[metric] {
+				r.P = mannWhitneyUGreater(limit, vals)
+			} else {
+				r.P = mannWhitneyUGreater(vals, limit)
+			}
+			r.Significant = r.P <= alpha
+		}
+		if matched == 0 {
+			results = append(results, &gateResult{Budget: b, Metric: metric, Err: "no matching results"})
+		}
+	}
+	return results, nil
+}
+
+func matchesBudget(g *resultGroup, b *budget, paramIdx map[string]int) bool {
+	for name, val := range b.Params {
+		if g.Params[paramIdx[name]] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// describeGroup returns the params of g that are not fixed by the budget and
+// vary within rs.
+func describeGroup(rs *resultSet, g *resultGroup, b *budget) string {
+	var desc []string
+	for i, name := range rs.Params {
+		if _, ok := b.Params[name]; ok {
+			continue
+		}
+		for _, other := range rs.Groups {
+			if other.Params[i] != g.Params[i] {
+				desc = append(desc, name+"="+g.Params[i])
+				break
+			}
+		}
+	}
+	return strings.Join(desc, " ")
+}
+
+func printGateResults(w io.Writer, results []*gateResult) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "budget\tconfig\tmetric\toverhead\tmax\tp\tresult\t")
+	for _, r := range results {
+		selector := r.Budget.Line[:strings.LastIndex(r.Budget.Line, ":")]
+		config := r.Config
+		if config == "" {
+			config = "-"
+		}
+		overhead, p, result := "-", "-", "ok"
+		if r.Err == "" {
+			overhead = fmt.Sprintf("%+.2f%%", r.Overhead)
+			p = fmt.Sprintf("%.3f", r.P)
+		}
+		switch {
+		case r.Err != "":
+			result = "FAIL (" + r.Err + ")"
+		case r.Failed():
+			result = "FAIL"
+		case r.Exceeded:
+			result = "ok (not significant)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s%%\t%s\t%s\t\n",
+			selector, config, r.Metric, overhead,
+			strconv.FormatFloat(r.Budget.MaxOverhead, 'f', -1, 64), p, result,
+		)
+	}
+	return tw.Flush()
+}
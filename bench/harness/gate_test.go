@@ -0,0 +1,167 @@
+package harness
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseBudget(t *testing.T) {
+	b, err := parseBudget("mutex, depth=16, blockprofilerate=10000: max 5% overhead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.MaxOverhead, 5.0; got != want {
+		t.Errorf("max overhead: got %v, want %v", got, want)
+	}
+	want := map[string]string{"workload": "mutex", "depth": "16", "blockprofilerate": "10000"}
+	for k, v := range want {
+		if b.Params[k] != v {
+			t.Errorf("%s: got %q, want %q", k, b.Params[k], v)
+		}
+	}
+
+	if b, err := parseBudget("chan: max 2.5% p99_ns overhead"); err != nil {
+		t.Fatal(err)
+	} else if b.Metric != "p99_ns" || b.MaxOverhead != 2.5 {
+		t.Errorf("got metric %q and max %v", b.Metric, b.MaxOverhead)
+	}
+
+	for _, line := range []string{"mutex", "mutex: at most 5%", "mutex, ms=3: max 5% overhead"} {
+		if _, err := parseBudget(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+func TestCheckBudgets(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`workload,blockprofilerate,run,ms
+mutex,0,1,10
+mutex,0,2,10.1
+mutex,0,3,9.9
+mutex,0,4,10
+mutex,0,5,10.2
+mutex,100,1,12
+mutex,100,2,12.1
+mutex,100,3,11.9
+mutex,100,4,12
+mutex,100,5,12.2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line   string
+		failed bool
+	}{
+		{"mutex, blockprofilerate=100: max 5% overhead", true},
+		{"mutex, blockprofilerate=100: max 25% overhead", false},
+		// Exceeded, but the difference is within the noise.
+		{"mutex, blockprofilerate=100: max 19.5% overhead", false},
+		{"mutex: max 25% overhead", false},
+		{"chan: max 5% overhead", true},
+	}
+	for _, test := range tests {
+		b, err := parseBudget(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := checkBudgets(rs, []*budget{b}, "ms", 0.05)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(results) != 1 {
+			t.Fatalf("%q: got %d results, want 1", test.line, len(results))
+		} else if got := results[0].Failed(); got != test.failed {
+			t.Errorf("%q: got failed=%v, want %v", test.line, got, test.failed)
+		}
+	}
+}
+
+func TestCheckBudgetsFewRuns(t *testing.T) {
+	// 3 runs are the minimum for the one-sided test to reach an alpha of
+	// 0.05, 2 runs can never fail the check.
+	rs, err := parseResultSet(strings.NewReader(`workload,blockprofilerate,run,ms
+mutex,0,1,10
+mutex,0,2,10.1
+mutex,0,3,9.9
+mutex,100,1,12
+mutex,100,2,12.1
+mutex,100,3,11.9
+chan,0,1,10
+chan,0,2,10.1
+chan,100,1,10
+chan,100,2,10.1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		err  bool
+	}{
+		{"mutex, blockprofilerate=100: max 5% overhead", false},
+		{"chan, blockprofilerate=100: max 5% overhead", true},
+	}
+	for _, test := range tests {
+		b, err := parseBudget(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := checkBudgets(rs, []*budget{b}, "ms", 0.05)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(results) != 1 {
+			t.Fatalf("%q: got %d results, want 1", test.line, len(results))
+		} else if r := results[0]; !r.Failed() {
+			t.Errorf("%q: got ok, want failure", test.line)
+		} else if got := r.Err != ""; got != test.err {
+			t.Errorf("%q: got error %q, want error=%v", test.line, r.Err, test.err)
+		}
+	}
+}
+
+func TestCheckBudgetsHigherIsBetter(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`workload,mode,blockprofilerate,run,ms,ops_per_sec
+mutex,duration,0,1,100,1000
+mutex,duration,0,2,100,1010
+mutex,duration,0,3,100,990
+mutex,duration,100,1,100,800
+mutex,duration,100,2,100,810
+mutex,duration,100,3,100,790
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rs.defaultMetric(), "ops_per_sec"; got != want {
+		t.Fatalf("default metric: got %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		line     string
+		overhead float64
+		failed   bool
+	}{
+		{"mutex: max 5% overhead", 20, true},
+		{"mutex: max 25% overhead", 20, false},
+		// ms is constant when running for a fixed duration.
+		{"mutex: max 5% ms overhead", 0, false},
+	}
+	for _, test := range tests {
+		b, err := parseBudget(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := checkBudgets(rs, []*budget{b}, rs.defaultMetric(), 0.05)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(results) != 1 {
+			t.Fatalf("%q: got %d results, want 1", test.line, len(results))
+		} else if r := results[0]; math.Abs(r.Overhead-test.overhead) > 0.001 {
+			t.Errorf("%q: got overhead %v, want %v", test.line, r.Overhead, test.overhead)
+		} else if got := r.Failed(); got != test.failed {
+			t.Errorf("%q: got failed=%v, want %v", test.line, got, test.failed)
+		}
+	}
+}
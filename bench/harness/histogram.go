@@ -0,0 +1,143 @@
+package harness
+
+import (
+	"math/bits"
+	"time"
+)
+
+// histSubBits controls the precision of Histogram. Every power of two range
+// is divided into 2^histSubBits linear sub-buckets, which bounds the relative
+// error of reported values to 1/2^histSubBits (< 1% for 7 bits).
+const histSubBits = 7
+
+// Histogram is a HDR-style log-linear histogram for recording latencies with
+// nanosecond resolution. It's not safe for concurrent use, so workloads should
+// use one histogram per goroutine and Merge them afterwards.
+type Histogram struct {
+	counts []uint64
+	total  uint64
+	sum    int64
+	max    int64
+}
+
+// NewHistogram returns a new empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// RecordSince records the time since start, unless start is zero because the
+// latency of the operation is not sampled, see WorkloadParams.StartOp.
+func (h *Histogram) RecordSince(start time.Time) {
+	if !start.IsZero() {
+		h.Record(time.Since(start))
+	}
+}
+
+// Record adds the given duration to the histogram. Negative durations are
+// recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	i := histBucket(v)
+	if i >= len(h.counts) {
+		counts := make([]uint64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds all values recorded by o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.counts) > len(h.counts) {
+		counts := make([]uint64, len(o.counts))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// MergeHistograms returns a new histogram containing the values of all hists.
+func MergeHistograms(hists []*Histogram) *Histogram {
+	merged := NewHistogram()
+	for _, h := range hists {
+		merged.Merge(h)
+	}
+	return merged
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+// Sum returns the sum of all recorded values.
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(h.sum)
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+// Quantile returns the value below which the fraction q of all recorded values
+// fall, e.g. q=0.99 for the p99. The result is the highest value equivalent
+// to the bucket containing the quantile, capped at Max.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	} else if rank > h.total {
+		rank = h.total
+	}
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := histBucketMax(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// histBucket returns the bucket index for the value v >= 0.
+func histBucket(v int64) int {
+	if v < 1<<histSubBits {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBits - 1
+	top := v >> shift
+	return (shift+1)<<histSubBits + int(top-1<<histSubBits)
+}
+
+// histBucketMax returns the highest value that maps to bucket i.
+func histBucketMax(i int) int64 {
+	if i < 1<<histSubBits {
+		return int64(i)
+	}
+	shift := i>>histSubBits - 1
+	top := int64(i&(1<<histSubBits-1)) + 1<<histSubBits
+	return (top+1)<<shift - 1
+}
@@ -0,0 +1,53 @@
+package harness
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	prev := -1
+	for v := int64(0); v < 1<<20; v++ {
+		i := histBucket(v)
+		if i != prev && i != prev+1 {
+			t.Fatalf("bucket for %d: got %d, want %d or %d", v, i, prev, prev+1)
+		} else if max := histBucketMax(i); v > max {
+			t.Fatalf("value %d exceeds max %d of bucket %d", v, max, i)
+		} else if i != prev && prev >= 0 && histBucketMax(prev) != v-1 {
+			t.Fatalf("bucket %d ends at %d, want %d", prev, histBucketMax(prev), v-1)
+		}
+		prev = i
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 500 * time.Microsecond},
+		{0.9, 900 * time.Microsecond},
+		{0.99, 990 * time.Microsecond},
+		{1, 1000 * time.Microsecond},
+	}
+	for _, test := range tests {
+		got := h.Quantile(test.q)
+		if diff := float64(got-test.want) / float64(test.want); diff < 0 || diff > 1.0/(1<<histSubBits) {
+			t.Errorf("q=%v: got %s, want %s", test.q, got, test.want)
+		}
+	}
+	if got := h.Max(); got != time.Millisecond {
+		t.Errorf("max: got %s, want %s", got, time.Millisecond)
+	}
+
+	merged := MergeHistograms([]*Histogram{h, h})
+	if got, want := merged.Count(), uint64(2000); got != want {
+		t.Errorf("merged count: got %d, want %d", got, want)
+	} else if got, want := merged.Quantile(0.5), h.Quantile(0.5); got != want {
+		t.Errorf("merged p50: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes every row as a JSON object on its own line (JSON Lines).
+// The keys of the object are the column names.
+type jsonWriter struct {
+	w io.Writer
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{w: w}
+}
+
+func (j *jsonWriter) WriteRow(values []interface{}) error {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, col := range Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteString("}\n")
+	_, err := buf.WriteTo(j.w)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,605 @@
+// Package harness implements the bench command for measuring the overhead of
+// the Go profilers, so that other programs can benchmark their own workloads
+// with it.
+//
+// A leader process runs a Sweep over the configurations, starting a new
+// worker process for every one of them. The worker sets the profiler rates,
+// runs the Workload and reports a Record to the leader. Programs embedding the
+// harness register their workloads with RegisterWorkload and call Main, which
+// makes the same binary act as the leader or the worker.
+package harness
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Main runs the bench command using the workloads registered with
+// RegisterWorkload and exits the process when it's done. Depending on the
+// arguments, it runs a sweep, one of the summarize, report or gate
+// subcommands, or the worker if the process was started by a Sweep.
+func Main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// workerEnv is the environment variable set by the leader for starting the
+// worker processes.
+const workerEnv = "WORKER"
+
+// IsWorker returns true if the current process was started as a worker by a
+// Sweep. Programs running their own sweep instead of calling Main must call
+// Worker in this case.
+func IsWorker() bool {
+	return os.Getenv(workerEnv) != ""
+}
+
+func run() error {
+	if IsWorker() {
+		return Worker()
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "summarize":
+			return summarize(os.Args[2:])
+		case "report":
+			return report(os.Args[2:])
+		case "gate":
+			return gate(os.Args[2:])
+		}
+	}
+	return leader(os.Args[1:])
+}
+
+// collectDuration is how long workloads that collect goroutine profiles run
+// unless -ops or -duration is given. Their operations take about 1µs, so the
+// default -ops would complete before the first collection.
+const collectDuration = 100 * time.Millisecond
+
+func leader(args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var (
+		blockprofilerates     = flagIntSlice(fs, "blockprofilerates", []int{0, 1, 10, 100, 1000, 10000, 100000, 1000000}, "The runtime.SetBlockProfileRate() values to benchmark.")
+		mutexprofilefractions = flagIntSlice(fs, "mutexprofilefractions", []int{0}, "The runtime.SetMutexProfileFraction() values to benchmark.")
+		cpuprofilerates       = flagIntSlice(fs, "cpuprofilerates", []int{0}, "The runtime.SetCPUProfileRate() values to benchmark. 0 disables the cpu profiler.")
+		memprofilerates       = flagIntSlice(fs, "memprofilerates", []int{DefaultMemProfileRate}, "The runtime.MemProfileRate values to benchmark. 0 disables the heap profiler.")
+		bufsizes              = flagIntSlice(fs, "bufsizes", []int{0, 64}, "The buffer sizes to use for channel operations (not applicable to all workloads).")
+		lockGoroutines        = flagIntSlice(fs, "lockgoroutines", []int{2}, "The number of goroutines sharing the same lock (not applicable to all workloads).")
+		criticalSections      = flagDurationSlice(fs, "criticalsections", []time.Duration{0}, "The durations of simulated work inside of critical sections (not applicable to all workloads).")
+		idleGoroutines        = flagIntSlice(fs, "idlegoroutines", []int{1000}, "The number of additional goroutines that stay blocked during the workload (not applicable to all workloads).")
+		goroutineDebugs       = flagIntSlice(fs, "goroutinedebugs", []int{0, 1, 2}, "The debug values to use for collecting goroutine profiles (not applicable to all workloads).")
+		collectIntervals      = flagDurationSlice(fs, "collectintervals", []time.Duration{0, 10 * time.Millisecond}, "The intervals at which to collect goroutine profiles, 0 disables collection (not applicable to all workloads).")
+		labels                = flagStringSlice(fs, "labels", []string{"none"}, "The pprof labels to set: none, <n> labels per goroutine or <n>/op labels per operation (only applicable to the labels workload).")
+		depths                = flagIntSlice(fs, "depths", []int{2, 4, 8, 16, 32}, "The different frame depths values to use for each workload.")
+		goroutines            = flagIntSlice(fs, "goroutines", []int{runtime.NumCPU()}, "The number of goroutine values to use for each workloads.")
+		ops                   = fs.Int("ops", 1000, "The number of operations to perform for each workload. Workloads collecting goroutine profiles run for "+collectDuration.String()+" instead, unless -ops is given explicitly.")
+		latencySample         = fs.Int("latencysample", 1, "Record the latency of every n-th operation, 0 disables latency recording.")
+		duration              = fs.Duration("duration", 0, "Run every workload for the given duration instead of a fixed number of -ops and report the throughput.")
+		runs                  = fs.Int("runs", 3, "The number of times to repeat the same benchmark to understand variance.")
+		runtimeMetrics        = flagStringSlice(fs, "metrics", nil, "The runtime/metrics to capture as additional columns, or \"all\". Available: "+strings.Join(runtimeMetricColumns(), ", ")+".")
+		parallel              = fs.Int("parallel", 1, "The number of worker processes to run at the same time.")
+		pin                   = fs.Bool("pin", runtime.GOOS == "linux", "Pin every parallel worker process to its own set of cpus (linux only).")
+		retries               = fs.Int("retries", 0, "The number of times to retry a failed worker run.")
+		onFailure             = fs.String("onfailure", OnFailureSkip, "What to do when a worker run keeps failing: \"skip\" reports the error in the csv, \"abort\" stops the sweep.")
+		checkpoint            = fs.String("checkpoint", "", "Path to a file for recording completed runs. Runs found in an existing file are not repeated, so an interrupted sweep can be resumed.")
+		format                = fs.String("format", FormatCSV, "The output format: csv, json (JSON Lines) or parquet.")
+		toolchains            = flagStringSlice(fs, "toolchains", nil, "The GOROOTs of the Go toolchains to build the worker with. Defaults to running the worker with the current binary.")
+		envFile               = fs.String("envfile", "", "Path to a file for writing the environment fingerprint. It's also embedded into parquet output.")
+		csvEnv                = fs.Bool("csvenv", false, "Embed the environment fingerprint into csv output as \"# key: value\" lines before the header row. Not all csv readers can skip them.")
+		workloads             = flagStringSlice(fs, "workloads", []string{"mutex", "chan"}, "The workloads to benchmark, the others have to be selected explicitly. Use \"list\" to print the available workloads.")
+	)
+	fs.Parse(args)
+	opsSet := false
+	fs.Visit(func(f *flag.Flag) { opsSet = opsSet || f.Name == "ops" })
+
+	if len(*workloads) == 1 && (*workloads)[0] == "list" {
+		return listWorkloads(os.Stdout)
+	}
+	for _, name := range *workloads {
+		if _, err := LookupWorkload(name); err != nil {
+			return err
+		}
+	}
+	for _, l := range *labels {
+		if _, err := parseLabels(l); err != nil {
+			return err
+		}
+	}
+
+	if err := EnableRuntimeMetrics(*runtimeMetrics); err != nil {
+		return err
+	}
+	var workerArgs []string
+	if len(*runtimeMetrics) > 0 {
+		workerArgs = append(workerArgs, "-metrics", strings.Join(*runtimeMetrics, ","))
+	}
+
+	if *parallel > 1 && !*pin {
+		fmt.Fprintf(os.Stderr, "warning: running %d parallel workers without cpu pinning\n", *parallel)
+	}
+
+	env := CollectEnvironment()
+	goVersions := []string{runtime.Version()}
+	binaries := map[string]string{}
+	if len(*toolchains) > 0 {
+		dir, err := ioutil.TempDir("", "bench")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		built, err := buildToolchains(*toolchains, dir)
+		if err != nil {
+			return err
+		}
+		goVersions = nil
+		for _, tc := range built {
+			goVersions = append(goVersions, tc.Version)
+			binaries[tc.Version] = tc.Binary
+		}
+		// The results are produced by the workers, so the version of the
+		// leader doesn't matter.
+		env.Set("go_version", strings.Join(goVersions, ","))
+	}
+
+	var configs []*Record
+	for _, workload := range *workloads {
+		w, _ := LookupWorkload(workload)
+		workloadBufsizes := paramValues(w, ParamBufsize, *bufsizes, 0)
+		workloadLockGoroutines := paramValues(w, ParamLockGoroutines, *lockGoroutines, 0)
+		workloadCriticalSections := durationParamValues(w, ParamCriticalSection, *criticalSections, 0)
+		workloadIdleGoroutines := paramValues(w, ParamIdleGoroutines, *idleGoroutines, 0)
+		workloadGoroutineDebugs := paramValues(w, ParamGoroutineDebug, *goroutineDebugs, 0)
+		workloadCollectIntervals := durationParamValues(w, ParamCollectInterval, *collectIntervals, 0)
+		workloadLabels := stringParamValues(w, ParamLabels, *labels, "none")
+
+		workloadConfigs := []*Record{{Workload: workload, Mode: ModeOps, Ops: *ops, LatencySample: *latencySample}}
+		if *duration > 0 {
+			workloadConfigs = []*Record{{Workload: workload, Mode: ModeDuration, DurationLimit: *duration, LatencySample: *latencySample}}
+		} else if !opsSet && hasParam(w, ParamCollectInterval) {
+			workloadConfigs = []*Record{{Workload: workload, Mode: ModeDuration, DurationLimit: collectDuration, LatencySample: *latencySample}}
+		}
+		workloadConfigs = expand(workloadConfigs, len(goVersions), func(r *Record, i int) { r.GoVersion = goVersions[i] })
+		workloadConfigs = expand(workloadConfigs, len(*goroutines), func(r *Record, i int) { r.Goroutines = (*goroutines)[i] })
+		workloadConfigs = expand(workloadConfigs, len(*blockprofilerates), func(r *Record, i int) { r.Blockprofilerate = (*blockprofilerates)[i] })
+		workloadConfigs = expand(workloadConfigs, len(*mutexprofilefractions), func(r *Record, i int) { r.Mutexprofilefraction = (*mutexprofilefractions)[i] })
+		workloadConfigs = expand(workloadConfigs, len(*cpuprofilerates), func(r *Record, i int) { r.CPUProfileRate = (*cpuprofilerates)[i] })
+		workloadConfigs = expand(workloadConfigs, len(*memprofilerates), func(r *Record, i int) { r.MemProfileRate = (*memprofilerates)[i] })
+		workloadConfigs = expand(workloadConfigs, len(*depths), func(r *Record, i int) { r.Depth = (*depths)[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadBufsizes), func(r *Record, i int) { r.Bufsize = workloadBufsizes[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadLockGoroutines), func(r *Record, i int) { r.LockGoroutines = workloadLockGoroutines[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadCriticalSections), func(r *Record, i int) { r.CriticalSection = workloadCriticalSections[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadIdleGoroutines), func(r *Record, i int) { r.IdleGoroutines = workloadIdleGoroutines[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadCollectIntervals), func(r *Record, i int) { r.CollectInterval = workloadCollectIntervals[i] })
+		workloadConfigs = expandCollecting(workloadConfigs, len(workloadGoroutineDebugs), func(r *Record, i int) { r.GoroutineDebug = workloadGoroutineDebugs[i] })
+		workloadConfigs = expand(workloadConfigs, len(workloadLabels), func(r *Record, i int) { r.Labels = workloadLabels[i] })
+		workloadConfigs = expand(workloadConfigs, *runs, func(r *Record, i int) { r.Run = i + 1 })
+		configs = append(configs, workloadConfigs...)
+	}
+
+	if *envFile != "" {
+		buf := &bytes.Buffer{}
+		writeEnvHeader(buf, env)
+		if err := ioutil.WriteFile(*envFile, buf.Bytes(), 0666); err != nil {
+			return err
+		}
+	}
+
+	outEnv := env
+	if *format == FormatCSV && !*csvEnv {
+		outEnv = nil
+	}
+	out, err := NewResultWriter(*format, os.Stdout, outEnv)
+	if err != nil {
+		return err
+	}
+
+	s := &Sweep{
+		Configs:    configs,
+		WorkerArgs: workerArgs,
+		Binaries:   binaries,
+		Parallel:   *parallel,
+		Pin:        *pin && *parallel > 1,
+		Retries:    *retries,
+		OnFailure:  *onFailure,
+		Checkpoint: *checkpoint,
+		Out:        out,
+	}
+	if err := s.Run(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Worker runs a single workload as configured by the command line flags and
+// writes the resulting Record to stdout. It's the counterpart of Sweep, which
+// starts the worker processes with the flags of every config.
+func Worker() error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var (
+		blockprofilerate     = fs.Int("blockprofilerate", 1, "The block profile rate to use.")
+		mutexprofilefraction = fs.Int("mutexprofilefraction", 0, "The mutex profile fraction to use.")
+		cpuprofilerate       = fs.Int("cpuprofilerate", 0, "The cpu profile rate in Hz to use. 0 disables the cpu profiler.")
+		memprofilerate       = fs.Int("memprofilerate", DefaultMemProfileRate, "The runtime.MemProfileRate to use. 0 disables the heap profiler.")
+		bufsize              = fs.Int("bufsize", 0, "The buffer size to use for channel operations (not applicable to all workloads).")
+		lockGoroutines       = fs.Int("lockgoroutines", 2, "The number of goroutines sharing the same lock (not applicable to all workloads).")
+		criticalSection      = fs.Duration("criticalsection", 0, "The duration of simulated work inside of critical sections (not applicable to all workloads).")
+		idleGoroutines       = fs.Int("idlegoroutines", 0, "The number of additional goroutines that stay blocked during the workload (not applicable to all workloads).")
+		goroutineDebug       = fs.Int("goroutinedebug", 0, "The debug value to use for collecting goroutine profiles (not applicable to all workloads).")
+		collectInterval      = fs.Duration("collectinterval", 0, "The interval at which to collect goroutine profiles, 0 disables collection (not applicable to all workloads).")
+		labels               = fs.String("labels", "none", "The pprof labels to set: none, <n> labels per goroutine or <n>/op labels per operation (only applicable to the labels workload).")
+		depth                = fs.Int("depth", 16, "The stack depth at which to perform blocking events.")
+		runtimeMetrics       = flagStringSlice(fs, "metrics", nil, "The runtime/metrics to capture as additional columns, or \"all\".")
+		cpus                 = flagIntSlice(fs, "cpus", nil, "The cpus to pin the process to (linux only).")
+		goroutines           = fs.Int("goroutines", runtime.NumCPU(), "The number of goroutines to utilize.")
+		ops                  = fs.Int("ops", 100000, "The number of operations to perform.")
+		latencySample        = fs.Int("latencysample", 1, "Record the latency of every n-th operation, 0 disables latency recording.")
+		duration             = fs.Duration("duration", 0, "Perform operations until the duration has passed instead of performing -ops operations.")
+		out                  = fs.String("blockprofile", "", "Path to a file for writing the block profile.")
+		stacksout            = fs.String("blockstacks", "", "Path to a file for writing the block profile accuracy of every stack.")
+		mutexout             = fs.String("mutexprofile", "", "Path to a file for writing the mutex profile.")
+		cpuout               = fs.String("cpuprofile", "", "Path to a file for writing the cpu profile.")
+		memout               = fs.String("memprofile", "", "Path to a file for writing the heap profile.")
+		run                  = fs.Int("run", 1, "The number of run. Has no impact on the benchmark, but gets included in the output.")
+		format               = fs.String("format", FormatCSV, "The output format: csv, json or parquet.")
+		workload             = fs.String("workload", "mutex", "The workload to simulate.")
+	)
+	fs.Parse(os.Args[1:])
+
+	if err := EnableRuntimeMetrics(*runtimeMetrics); err != nil {
+		return err
+	}
+
+	if len(*cpus) > 0 {
+		if err := pinCPUs(*cpus); err != nil {
+			return err
+		}
+		runtime.GOMAXPROCS(len(*cpus))
+	}
+
+	runtime.MemProfileRate = *memprofilerate
+	if *blockprofilerate > 0 {
+		runtime.SetBlockProfileRate(*blockprofilerate)
+	}
+	if *mutexprofilefraction > 0 {
+		runtime.SetMutexProfileFraction(*mutexprofilefraction)
+	}
+
+	w, err := LookupWorkload(*workload)
+	if err != nil {
+		return err
+	}
+
+	cpuBuf := &bytes.Buffer{}
+	if *cpuprofilerate > 0 {
+		// StartCPUProfile always tries to set the rate to 100 Hz, which fails
+		// with a warning on stderr if a different rate was set before. See
+		// guide/cpu-rate.go.
+		runtime.SetCPUProfileRate(*cpuprofilerate)
+		if err := pprof.StartCPUProfile(cpuBuf); err != nil {
+			return err
+		}
+	}
+	// The cpu time is only used to estimate the number of expected cpu
+	// profile samples, so failing to read it is not fatal.
+	cpuTimeStart, cpuTimeErr := processCPUTime()
+
+	mode := ModeOps
+	mr := startMetricsRecorder(metricColumns())
+	start := time.Now()
+	var deadline time.Time
+	if *duration > 0 {
+		mode = ModeDuration
+		deadline = start.Add(*duration)
+	}
+	result, err := w.Run(WorkloadParams{
+		Goroutines:      *goroutines,
+		Ops:             *ops,
+		LatencySample:   *latencySample,
+		Depth:           *depth,
+		Bufsize:         *bufsize,
+		LockGoroutines:  *lockGoroutines,
+		CriticalSection: *criticalSection,
+		GoroutineDebug:  *goroutineDebug,
+		CollectInterval: *collectInterval,
+		IdleGoroutines:  *idleGoroutines,
+		Labels:          *labels,
+		Deadline:        deadline,
+	})
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	metricValues := mr.Stop()
+
+	var cpuStats *CPUProfileStats
+	if *cpuprofilerate > 0 {
+		var cpuTime time.Duration
+		if cpuTimeEnd, err := processCPUTime(); err == nil && cpuTimeErr == nil {
+			cpuTime = cpuTimeEnd - cpuTimeStart
+		}
+		pprof.StopCPUProfile()
+		if *cpuout != "" {
+			if err := ioutil.WriteFile(*cpuout, cpuBuf.Bytes(), 0666); err != nil {
+				return err
+			}
+		}
+		prof, err := parseProfile(cpuBuf)
+		if err != nil {
+			return fmt.Errorf("cpu profile: %w", err)
+		}
+		if cpuStats, err = cpuProfileSamples(prof, *cpuprofilerate, cpuTime); err != nil {
+			return err
+		}
+	}
+
+	var blockAccuracy *ProfileAccuracy
+	if *blockprofilerate > 0 {
+		buf := &bytes.Buffer{}
+		if err := pprof.Lookup("block").WriteTo(buf, 0); err != nil {
+			return err
+		}
+		if *out != "" {
+			if err := ioutil.WriteFile(*out, buf.Bytes(), 0666); err != nil {
+				return err
+			}
+		}
+		prof, err := parseProfile(buf)
+		if err != nil {
+			return fmt.Errorf("block profile: %w", err)
+		}
+		if blockAccuracy, err = blockProfileAccuracy(prof, result, profileFrame(w), *latencySample); err != nil {
+			return err
+		}
+		if *stacksout != "" {
+			stacksBuf := &bytes.Buffer{}
+			if err := blockAccuracy.WriteStacks(stacksBuf); err != nil {
+				return err
+			} else if err := ioutil.WriteFile(*stacksout, stacksBuf.Bytes(), 0666); err != nil {
+				return err
+			}
+		}
+	}
+	var heapBuckets int
+	if *memprofilerate > 0 {
+		// The heap profile only includes allocations up to the last completed
+		// GC cycle.
+		runtime.GC()
+		heapBuckets, _ = runtime.MemProfile(nil, true)
+		if *memout != "" {
+			if err := writeProfile("allocs", *memout); err != nil {
+				return err
+			}
+		}
+	}
+	if *mutexprofilefraction > 0 && *mutexout != "" {
+		if err := writeProfile("mutex", *mutexout); err != nil {
+			return err
+		}
+	}
+
+	rw, err := NewResultWriter(*format, os.Stdout, nil)
+	if err != nil {
+		return err
+	}
+	record := &Record{
+		BlockAccuracy:        blockAccuracy,
+		Blockprofilerate:     *blockprofilerate,
+		Mutexprofilefraction: *mutexprofilefraction,
+		CPUProfileRate:       *cpuprofilerate,
+		CPUProfile:           cpuStats,
+		MemProfileRate:       *memprofilerate,
+		AllocBytes:           result.AllocBytes,
+		HeapBuckets:          heapBuckets,
+		Bufsize:              *bufsize,
+		CriticalSection:      *criticalSection,
+		CollectInterval:      *collectInterval,
+		Collections:          result.Collections,
+		GoroutineDebug:       *goroutineDebug,
+		IdleGoroutines:       *idleGoroutines,
+		Labels:               *labels,
+		LockGoroutines:       *lockGoroutines,
+		Depth:                *depth,
+		Duration:             elapsed,
+		DurationLimit:        *duration,
+		GoVersion:            runtime.Version(),
+		Goroutines:           *goroutines,
+		Latencies:            result.Latencies,
+		Mode:                 mode,
+		Ops:                  *ops,
+		OpsCompleted:         result.Ops,
+		LatencySample:        *latencySample,
+		Run:                  *run,
+		RuntimeMetrics:       metricValues,
+		Workload:             *workload,
+	}
+	if err := rw.WriteRow(record.Values()); err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+// Modes of running workloads.
+const (
+	// ModeOps performs a fixed number of operations per goroutine.
+	ModeOps = "ops"
+	// ModeDuration performs operations until a deadline is reached.
+	ModeDuration = "duration"
+)
+
+// DefaultMemProfileRate is the default value of runtime.MemProfileRate.
+const DefaultMemProfileRate = 512 * 1024
+
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// expand returns the cartesian product of configs and n values, where set
+// assigns the i-th value to a copy of each config.
+func expand(configs []*Record, n int, set func(r *Record, i int)) []*Record {
+	var expanded []*Record
+	for _, config := range configs {
+		for i := 0; i < n; i++ {
+			r := *config
+			set(&r, i)
+			expanded = append(expanded, &r)
+		}
+	}
+	return expanded
+}
+
+// expandCollecting is like expand, but only for configs that collect
+// goroutine profiles. The other configs are kept as they are, as e.g. the
+// goroutine debug value doesn't make a difference for them.
+func expandCollecting(configs []*Record, n int, set func(r *Record, i int)) []*Record {
+	var expanded []*Record
+	for _, config := range configs {
+		if config.CollectInterval == 0 {
+			expanded = append(expanded, config)
+			continue
+		}
+		expanded = append(expanded, expand([]*Record{config}, n, set)...)
+	}
+	return expanded
+}
+
+// paramValues returns vals if the workload supports param, otherwise it
+// returns na which indicates that the parameter is not applicable.
+func paramValues(w Workload, param string, vals []int, na int) []int {
+	if !hasParam(w, param) {
+		return []int{na}
+	}
+	return vals
+}
+
+// durationParamValues is like paramValues for duration parameters.
+func durationParamValues(w Workload, param string, vals []time.Duration, na time.Duration) []time.Duration {
+	if !hasParam(w, param) {
+		return []time.Duration{na}
+	}
+	return vals
+}
+
+// stringParamValues is like paramValues for string parameters.
+func stringParamValues(w Workload, param string, vals []string, na string) []string {
+	if !hasParam(w, param) {
+		return []string{na}
+	}
+	return vals
+}
+
+// SpinSleep is a more accurate version of time.Sleep() for short sleep
+// durations. It's used to simulate work without yielding to the scheduler.
+func SpinSleep(d time.Duration) {
+	start := time.Now()
+	for time.Since(start) < d {
+	}
+}
+
+// AtStackDepth calls fn with exactly depth frames on the stack, which makes
+// the stack depth of the profiled events a parameter of the benchmark. All
+// blocking operations of a workload must be performed by fn, since profile
+// samples without this frame are not attributed to the workload.
+func AtStackDepth(depth int, fn func()) {
+	pcs := make([]uintptr, depth*10)
+	n := runtime.Callers(1, pcs)
+	if n > depth {
+		panic("depth exceeded")
+	} else if n < depth {
+		AtStackDepth(depth, fn)
+		return
+	}
+
+	fn()
+}
+
+func flagIntSlice(fs *flag.FlagSet, name string, value []int, usage string) *[]int {
+	val := &intSlice{vals: value}
+	fs.Var(val, name, usage)
+	return &val.vals
+}
+
+type intSlice struct {
+	vals []int
+}
+
+func (i *intSlice) Set(val string) error {
+	var vals []int
+	for _, val := range strings.Split(val, ",") {
+		num, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, num)
+	}
+	i.vals = vals
+	return nil
+}
+
+func (i *intSlice) String() string {
+	return fmt.Sprintf("%v", i.vals)
+}
+
+func flagStringSlice(fs *flag.FlagSet, name string, value []string, usage string) *[]string {
+	val := &strSlice{vals: value}
+	fs.Var(val, name, usage)
+	return &val.vals
+}
+
+type strSlice struct {
+	vals []string
+}
+
+func (s *strSlice) Set(val string) error {
+	s.vals = strings.Split(val, ",")
+	return nil
+}
+
+func (s *strSlice) String() string {
+	return fmt.Sprintf("%v", s.vals)
+}
+
+func flagDurationSlice(fs *flag.FlagSet, name string, value []time.Duration, usage string) *[]time.Duration {
+	val := &durationSlice{vals: value}
+	fs.Var(val, name, usage)
+	return &val.vals
+}
+
+type durationSlice struct {
+	vals []time.Duration
+}
+
+func (d *durationSlice) Set(val string) error {
+	var vals []time.Duration
+	for _, val := range strings.Split(val, ",") {
+		dur, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, dur)
+	}
+	d.vals = vals
+	return nil
+}
+
+func (d *durationSlice) String() string {
+	return fmt.Sprintf("%v", d.vals)
+}
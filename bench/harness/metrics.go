@@ -0,0 +1,235 @@
+package harness
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeMetric describes a runtime/metrics value that can be reported as an
+// additional CSV column via the -metrics flag.
+type runtimeMetric struct {
+	// Column is the name of the CSV column.
+	Column string
+	// Name is the runtime/metrics name of the metric.
+	Name string
+	// Type is the type of the column.
+	Type ColumnType
+	// Value computes the column value from the samples taken before and
+	// after the workload. For Peak metrics, after holds the peak value.
+	Value func(before, after metrics.Value) float64
+	// Peak causes the metric to be sampled periodically while the workload
+	// is running, so that the maximum can be reported.
+	Peak bool
+}
+
+// peakInterval is the sampling interval for Peak metrics.
+const peakInterval = 10 * time.Millisecond
+
+var runtimeMetrics = []runtimeMetric{
+	{Column: "gc_cycles", Name: "/gc/cycles/total:gc-cycles", Type: IntType, Value: deltaUint64},
+	{Column: "heap_alloc_bytes", Name: "/gc/heap/allocs:bytes", Type: IntType, Value: deltaUint64},
+	{Column: "heap_alloc_objects", Name: "/gc/heap/allocs:objects", Type: IntType, Value: deltaUint64},
+	{Column: "sched_latency_p50_ns", Name: "/sched/latencies:seconds", Type: IntType, Value: deltaQuantileNs(0.5)},
+	{Column: "sched_latency_p99_ns", Name: "/sched/latencies:seconds", Type: IntType, Value: deltaQuantileNs(0.99)},
+	{Column: "mutex_wait_ms", Name: "/sync/mutex/wait/total:seconds", Type: FloatType, Value: func(before, after metrics.Value) float64 {
+		if after.Kind() != metrics.KindFloat64 {
+			return math.NaN()
+		}
+		return (after.Float64() - before.Float64()) * 1000
+	}},
+	{Column: "goroutines_max", Name: "/sched/goroutines:goroutines", Type: IntType, Peak: true, Value: func(_, after metrics.Value) float64 {
+		if after.Kind() != metrics.KindUint64 {
+			return math.NaN()
+		}
+		return float64(after.Uint64())
+	}},
+}
+
+// EnableRuntimeMetrics adds a column to Columns for each of the given runtime
+// metric column names. The special name "all" enables all runtime metrics.
+// The leader and the worker must enable the same metrics in the same order.
+func EnableRuntimeMetrics(names []string) error {
+	if len(names) == 1 && names[0] == "all" {
+		names = nil
+		for _, m := range runtimeMetrics {
+			names = append(names, m.Column)
+		}
+	}
+	for _, name := range names {
+		m, ok := lookupRuntimeMetric(name)
+		if !ok {
+			return fmt.Errorf("unknown metric: %q: available metrics: all, %s", name, strings.Join(runtimeMetricColumns(), ", "))
+		}
+		Columns = append(Columns, Column{m.Column, MetricColumn, m.Type, func(r *Record) interface{} {
+			val, ok := r.RuntimeMetrics[m.Column]
+			if !ok || math.IsNaN(val) {
+				return nil
+			} else if m.Type == IntType {
+				return int64(val)
+			}
+			return val
+		}})
+	}
+	return nil
+}
+
+// metricColumns returns the names of the enabled runtime metric columns.
+func metricColumns() []string {
+	var columns []string
+	for _, col := range Columns {
+		if _, ok := lookupRuntimeMetric(col.Name); ok {
+			columns = append(columns, col.Name)
+		}
+	}
+	return columns
+}
+
+func lookupRuntimeMetric(column string) (runtimeMetric, bool) {
+	for _, m := range runtimeMetrics {
+		if m.Column == column {
+			return m, true
+		}
+	}
+	return runtimeMetric{}, false
+}
+
+func runtimeMetricColumns() []string {
+	columns := make([]string, len(runtimeMetrics))
+	for i, m := range runtimeMetrics {
+		columns[i] = m.Column
+	}
+	return columns
+}
+
+// metricsRecorder captures the runtime metrics used by the enabled columns
+// before and after a workload.
+type metricsRecorder struct {
+	metrics []runtimeMetric
+	before  []metrics.Sample
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	peak []metrics.Sample
+}
+
+// startMetricsRecorder takes the initial snapshot of the given runtime metric
+// columns and starts sampling Peak metrics.
+func startMetricsRecorder(columns []string) *metricsRecorder {
+	mr := &metricsRecorder{stop: make(chan struct{})}
+	var peak []runtimeMetric
+	for _, column := range columns {
+		if m, ok := lookupRuntimeMetric(column); ok {
+			mr.metrics = append(mr.metrics, m)
+			if m.Peak {
+				peak = append(peak, m)
+			}
+		}
+	}
+	mr.before = readMetrics(mr.metrics)
+
+	if len(peak) > 0 {
+		mr.peak = readMetrics(peak)
+		mr.wg.Add(1)
+		go mr.samplePeaks(peak)
+	}
+	return mr
+}
+
+func (mr *metricsRecorder) samplePeaks(peak []runtimeMetric) {
+	defer mr.wg.Done()
+	ticker := time.NewTicker(peakInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			samples := readMetrics(peak)
+			mr.mu.Lock()
+			for i, s := range samples {
+				if s.Value.Kind() == metrics.KindUint64 && s.Value.Uint64() > mr.peak[i].Value.Uint64() {
+					mr.peak[i] = s
+				}
+			}
+			mr.mu.Unlock()
+		case <-mr.stop:
+			return
+		}
+	}
+}
+
+// Stop takes the final snapshot and returns the column values.
+func (mr *metricsRecorder) Stop() map[string]float64 {
+	after := readMetrics(mr.metrics)
+	close(mr.stop)
+	mr.wg.Wait()
+
+	values := map[string]float64{}
+	var peakIdx int
+	for i, m := range mr.metrics {
+		last := after[i].Value
+		if m.Peak {
+			if p := mr.peak[peakIdx].Value; p.Kind() == metrics.KindUint64 && p.Uint64() > last.Uint64() {
+				last = p
+			}
+			peakIdx++
+		}
+		values[m.Column] = m.Value(mr.before[i].Value, last)
+	}
+	return values
+}
+
+func readMetrics(ms []runtimeMetric) []metrics.Sample {
+	samples := make([]metrics.Sample, len(ms))
+	for i, m := range ms {
+		samples[i].Name = m.Name
+	}
+	metrics.Read(samples)
+	return samples
+}
+
+func deltaUint64(before, after metrics.Value) float64 {
+	if after.Kind() != metrics.KindUint64 {
+		return math.NaN()
+	}
+	return float64(after.Uint64() - before.Uint64())
+}
+
+// deltaQuantileNs returns a Value func computing the quantile q in nanoseconds
+// of the values added to a histogram metric in seconds between the two
+// samples.
+func deltaQuantileNs(q float64) func(before, after metrics.Value) float64 {
+	return func(before, after metrics.Value) float64 {
+		if after.Kind() != metrics.KindFloat64Histogram {
+			return math.NaN()
+		}
+		b, a := before.Float64Histogram(), after.Float64Histogram()
+		counts := make([]uint64, len(a.Counts))
+		var total uint64
+		for i := range a.Counts {
+			counts[i] = a.Counts[i] - b.Counts[i]
+			total += counts[i]
+		}
+		if total == 0 {
+			return 0
+		}
+
+		rank := uint64(math.Ceil(q * float64(total)))
+		var seen uint64
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				// Report the upper bound of the bucket, unless it's unbounded.
+				v := a.Buckets[i+1]
+				if math.IsInf(v, 1) {
+					v = a.Buckets[i]
+				}
+				return v * 1e9
+			}
+		}
+		return math.NaN()
+	}
+}
@@ -0,0 +1,79 @@
+package harness
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Output formats supported by the -format flag.
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+	FormatParquet = "parquet"
+)
+
+// ResultWriter writes rows of results in a specific output format. A row
+// holds the value of every column in Columns, see Record.Values.
+type ResultWriter interface {
+	WriteRow(values []interface{}) error
+	// Close flushes any buffered rows, but doesn't close the underlying
+	// writer.
+	Close() error
+}
+
+// NewResultWriter returns a ResultWriter for the given format. If env is not
+// nil, it's embedded into the output by the formats that support metadata,
+// i.e. as a header for csv and as key-value metadata for parquet.
+func NewResultWriter(format string, w io.Writer, env Environment) (ResultWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, env)
+	case FormatJSON:
+		return newJSONWriter(w), nil
+	case FormatParquet:
+		return newParquetWriter(w, env), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %q: must be %q, %q or %q", format, FormatCSV, FormatJSON, FormatParquet)
+	}
+}
+
+// decodeJSONRow decodes a row written by the JSON writer. The worker uses
+// this format to report its results to the leader, as it preserves the types
+// of all values.
+func decodeJSONRow(data []byte) ([]interface{}, error) {
+	var obj map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(Columns))
+	for i, col := range Columns {
+		raw, ok := obj[col.Name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var err error
+		switch col.Type {
+		case StringType:
+			var v string
+			err = json.Unmarshal(raw, &v)
+			values[i] = v
+		case IntType:
+			var v int64
+			err = json.Unmarshal(raw, &v)
+			values[i] = v
+		case FloatType:
+			var v float64
+			err = json.Unmarshal(raw, &v)
+			values[i] = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad %s value: %w", col.Name, err)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,211 @@
+package harness
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJSONRowRoundTrip(t *testing.T) {
+	r := &Record{
+		Workload:   "mutex",
+		Ops:        100,
+		Goroutines: 2,
+		Duration:   1500 * time.Microsecond,
+		Latencies:  NewHistogram(),
+		Run:        1,
+	}
+	r.Latencies.Record(42)
+	want := r.Values()
+
+	buf := &bytes.Buffer{}
+	if err := newJSONWriter(buf).WriteRow(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeJSONRow(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pw := newParquetWriter(buf, Environment{{"go_version", "go1.16"}})
+	failed := &Record{Workload: "chan", Run: 2, Error: "boom", Latencies: NewHistogram()}
+	failed.Latencies.Record(time.Millisecond)
+	var rows [][]interface{}
+	for _, r := range []*Record{{Workload: "mutex", Run: 1}, failed} {
+		rows = append(rows, r.Values())
+		if err := pw.WriteRow(r.Values()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		t.Fatalf("missing magic number")
+	}
+	metaLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if metaLen <= 0 || metaLen > len(data)-12 {
+		t.Fatalf("bad footer length: %d", metaLen)
+	}
+	meta, err := (&thriftReader{data: data[len(data)-8-metaLen : len(data)-8]}).readStruct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := meta[3]; got != int64(2) {
+		t.Errorf("num_rows: got %v, want 2", got)
+	}
+	if got := meta[5].([]interface{})[0].(thriftFields)[2]; string(got.([]byte)) != "go1.16" {
+		t.Errorf("key_value_metadata: got %q, want go1.16", got)
+	}
+
+	schema := meta[2].([]interface{})
+	if len(schema) != len(Columns)+1 {
+		t.Fatalf("schema: got %d elements, want %d", len(schema), len(Columns)+1)
+	}
+	chunks := meta[4].([]interface{})[0].(thriftFields)[1].([]interface{})
+	for i, col := range Columns {
+		elem := schema[i+1].(thriftFields)
+		if name := string(elem[4].([]byte)); name != col.Name {
+			t.Errorf("column %d: got name %q, want %q", i, name, col.Name)
+		} else if typ := elem[1]; typ != int64(parquetPhysicalType(col.Type)) {
+			t.Errorf("column %s: got type %v, want %d", col.Name, typ, parquetPhysicalType(col.Type))
+		}
+
+		want := []interface{}{rows[0][i], rows[1][i]}
+		offset := chunks[i].(thriftFields)[3].(thriftFields)[9].(int64)
+		got, err := readParquetPage(data[offset:], col.Type, 2)
+		if err != nil {
+			t.Fatalf("column %s: %s", col.Name, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("column %s: got %v, want %v", col.Name, got, want)
+		}
+	}
+}
+
+// readParquetPage decodes the data page written by parquetWriter.encodePage
+// at the start of data.
+func readParquetPage(data []byte, typ ColumnType, rows int) ([]interface{}, error) {
+	r := &thriftReader{data: data}
+	header, err := r.readStruct()
+	if err != nil {
+		return nil, err
+	}
+	page := data[r.pos : r.pos+int(header[2].(int64))]
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	levels := page[4 : 4+levelsLen]
+	if _, n := binary.Uvarint(levels); n > 0 {
+		levels = levels[n:]
+	}
+	values := page[4+levelsLen:]
+
+	var out []interface{}
+	for j := 0; j < rows; j++ {
+		if levels[j/8]&(1<<(j%8)) == 0 {
+			out = append(out, nil)
+			continue
+		}
+		switch typ {
+		case StringType:
+			n := int(binary.LittleEndian.Uint32(values))
+			out = append(out, string(values[4:4+n]))
+			values = values[4+n:]
+		case IntType:
+			out = append(out, int64(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		case FloatType:
+			out = append(out, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+			values = values[8:]
+		}
+	}
+	return out, nil
+}
+
+// thriftFields maps field ids to their values.
+type thriftFields map[int16]interface{}
+
+// thriftReader decodes the subset of the thrift compact protocol written by
+// thriftWriter. Integers are returned as int64, binaries as []byte, lists
+// as []interface{} and structs as thriftFields.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) readStruct() (thriftFields, error) {
+	s := thriftFields{}
+	var id int16
+	for {
+		if r.pos >= len(r.data) {
+			return nil, fmt.Errorf("unexpected end of struct")
+		}
+		b := r.data[r.pos]
+		r.pos++
+		if b == 0 {
+			return s, nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.readVarint())
+		}
+		v, err := r.readValue(b & 0x0f)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", id, err)
+		}
+		s[id] = v
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.readVarint(), nil
+	case thriftBinary:
+		n := int(r.readUvarint())
+		b := r.data[r.pos : r.pos+n]
+		r.pos += n
+		return b, nil
+	case thriftList:
+		b := r.data[r.pos]
+		r.pos++
+		size := int(b >> 4)
+		if size == 15 {
+			size = int(r.readUvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			var err error
+			if list[i], err = r.readValue(b & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		return nil, fmt.Errorf("unsupported type: %d", typ)
+	}
+}
+
+func (r *thriftReader) readUvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) readVarint() int64 {
+	v := r.readUvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
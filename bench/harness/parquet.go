@@ -0,0 +1,319 @@
+package harness
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// parquetWriter buffers all rows in memory and writes them as a Parquet file
+// with a single row group on Close. Every column is optional, PLAIN encoded
+// and uncompressed, which keeps the implementation small enough to avoid
+// pulling in dependencies. See https://github.com/apache/parquet-format.
+type parquetWriter struct {
+	w    io.Writer
+	env  Environment
+	rows [][]interface{}
+}
+
+func newParquetWriter(w io.Writer, env Environment) *parquetWriter {
+	return &parquetWriter{w: w, env: env}
+}
+
+func (p *parquetWriter) WriteRow(values []interface{}) error {
+	p.rows = append(p.rows, values)
+	return nil
+}
+
+// Parquet enum values used by parquetWriter.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+	parquetUTF8     = 0
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+const parquetMagic = "PAR1"
+
+func (p *parquetWriter) Close() error {
+	file := &bytes.Buffer{}
+	file.WriteString(parquetMagic)
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(Columns))
+	for i, col := range Columns {
+		page, err := p.encodePage(i, col)
+		if err != nil {
+			return err
+		}
+
+		header := &thriftWriter{}
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structBegin(5)
+		header.i32(1, int32(len(p.rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.stop()
+
+		chunks[i].offset = int64(file.Len())
+		file.Write(header.Bytes())
+		file.Write(page)
+		chunks[i].size = int64(file.Len()) - chunks[i].offset
+	}
+
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(Columns)+1)
+	meta.elemBegin()
+	meta.binary(4, []byte("schema"))
+	meta.i32(5, int32(len(Columns)))
+	meta.elemEnd()
+	for _, col := range Columns {
+		meta.elemBegin()
+		meta.i32(1, parquetPhysicalType(col.Type))
+		meta.i32(3, parquetOptional)
+		meta.binary(4, []byte(col.Name))
+		if col.Type == StringType {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, int64(len(p.rows)))
+
+	var totalSize int64
+	for _, c := range chunks {
+		totalSize += c.size
+	}
+	meta.listBegin(4, thriftStruct, 1)
+	meta.elemBegin()
+	meta.listBegin(1, thriftStruct, len(Columns))
+	for i, col := range Columns {
+		meta.elemBegin()
+		meta.i64(2, chunks[i].offset)
+		meta.structBegin(3)
+		meta.i32(1, parquetPhysicalType(col.Type))
+		meta.listBegin(2, thriftI32, 2)
+		meta.listI32(parquetPlain)
+		meta.listI32(parquetRLE)
+		meta.listBegin(3, thriftBinary, 1)
+		meta.listBinary([]byte(col.Name))
+		meta.i32(4, parquetUncompressed)
+		meta.i64(5, int64(len(p.rows)))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.structEnd()
+		meta.elemEnd()
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(len(p.rows)))
+	meta.elemEnd()
+	if len(p.env) > 0 {
+		meta.listBegin(5, thriftStruct, len(p.env))
+		for _, v := range p.env {
+			meta.elemBegin()
+			meta.binary(1, []byte(v.Key))
+			meta.binary(2, []byte(v.Value))
+			meta.elemEnd()
+		}
+	}
+	meta.binary(6, []byte("go-profiler-notes bench"))
+	meta.stop()
+
+	file.Write(meta.Bytes())
+	binary.Write(file, binary.LittleEndian, uint32(len(meta.Bytes())))
+	file.WriteString(parquetMagic)
+	_, err := file.WriteTo(p.w)
+	return err
+}
+
+// encodePage returns the data page for the column with index i, consisting of
+// the definition levels followed by the PLAIN encoded non-null values.
+func (p *parquetWriter) encodePage(i int, col Column) ([]byte, error) {
+	levels := make([]bool, len(p.rows))
+	values := &bytes.Buffer{}
+	for j, row := range p.rows {
+		v := row[i]
+		if v == nil {
+			continue
+		}
+		levels[j] = true
+		switch col.Type {
+		case StringType:
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("bad %s value: %#v", col.Name, v)
+			}
+			binary.Write(values, binary.LittleEndian, uint32(len(s)))
+			values.WriteString(s)
+		case IntType:
+			n, ok := v.(int64)
+			if !ok {
+				return nil, fmt.Errorf("bad %s value: %#v", col.Name, v)
+			}
+			binary.Write(values, binary.LittleEndian, n)
+		case FloatType:
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("bad %s value: %#v", col.Name, v)
+			}
+			binary.Write(values, binary.LittleEndian, math.Float64bits(f))
+		}
+	}
+
+	// Definition levels are encoded using the RLE/bit-packing hybrid with a
+	// bit width of 1, prefixed by their length. A single bit-packed run is
+	// used for simplicity.
+	groups := (len(levels) + 7) / 8
+	rle := appendUvarint(nil, uint64(groups<<1|1))
+	packed := make([]byte, groups)
+	for j, defined := range levels {
+		if defined {
+			packed[j/8] |= 1 << (j % 8)
+		}
+	}
+	rle = append(rle, packed...)
+
+	page := &bytes.Buffer{}
+	binary.Write(page, binary.LittleEndian, uint32(len(rle)))
+	page.Write(rle)
+	page.Write(values.Bytes())
+	return page.Bytes(), nil
+}
+
+func parquetPhysicalType(t ColumnType) int32 {
+	switch t {
+	case IntType:
+		return parquetInt64
+	case FloatType:
+		return parquetDouble
+	default:
+		return parquetByteArray
+	}
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter implements the subset of the thrift compact protocol needed
+// for encoding Parquet metadata.
+type thriftWriter struct {
+	bytes.Buffer
+	// lastIDs holds the last field id written for each nested struct.
+	lastIDs []int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	var last int16
+	if len(t.lastIDs) > 0 {
+		last = t.lastIDs[len(t.lastIDs)-1]
+	} else {
+		t.lastIDs = append(t.lastIDs, 0)
+	}
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.lastIDs[len(t.lastIDs)-1] = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	t.Write(appendUvarint(nil, v))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, b []byte) {
+	t.fieldHeader(id, thriftBinary)
+	t.listBinary(b)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) structEnd() {
+	t.elemEnd()
+}
+
+// elemBegin starts a struct that is an element of a list.
+func (t *thriftWriter) elemBegin() {
+	if len(t.lastIDs) == 0 {
+		t.lastIDs = append(t.lastIDs, 0)
+	}
+	t.lastIDs = append(t.lastIDs, 0)
+}
+
+// elemEnd ends a struct started by elemBegin or structBegin.
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.lastIDs = t.lastIDs[:len(t.lastIDs)-1]
+}
+
+// stop writes the end marker of the current struct.
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.WriteByte(0xf0 | elemType)
+		t.uvarint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) listBinary(b []byte) {
+	t.uvarint(uint64(len(b)))
+	t.Write(b)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
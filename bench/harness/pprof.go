@@ -0,0 +1,223 @@
+package harness
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// profile is a minimal representation of a pprof profile, see profile.proto
+// in the root of this repository. Only the fields needed by bench are decoded,
+// which allows bench to remain free of dependencies.
+type profile struct {
+	// SampleTypes holds the "type/unit" of every sample value.
+	SampleTypes []string
+	Samples     []profileSample
+}
+
+type profileSample struct {
+	Values []int64
+	// Stack holds the function names of the sample, leaf first.
+	Stack []string
+}
+
+// parseProfile decodes a gzip compressed or uncompressed pprof profile.
+func parseProfile(r io.Reader) (*profile, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(gr); err != nil {
+			return nil, err
+		}
+	}
+
+	type rawSample struct {
+		locationIDs []uint64
+		values      []int64
+	}
+	var (
+		sampleTypes [][2]int64
+		samples     []rawSample
+		locations   = map[uint64][]uint64{} // location id -> function ids
+		functions   = map[uint64]int64{}    // function id -> name string index
+		stringTable []string
+	)
+
+	err = decodeMessage(data, func(field int, wireType int, v uint64, b []byte) error {
+		switch field {
+		case 1: // sample_type
+			var st [2]int64
+			err := decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+				if field == 1 || field == 2 {
+					st[field-1] = int64(v)
+				}
+				return nil
+			})
+			sampleTypes = append(sampleTypes, st)
+			return err
+		case 2: // sample
+			var s rawSample
+			err := decodeMessage(b, func(field, wireType int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					return decodeRepeated(wireType, v, b, func(v uint64) { s.locationIDs = append(s.locationIDs, v) })
+				case 2:
+					return decodeRepeated(wireType, v, b, func(v uint64) { s.values = append(s.values, int64(v)) })
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case 4: // location
+			var (
+				id      uint64
+				funcIDs []uint64
+			)
+			err := decodeMessage(b, func(field, _ int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 4: // line
+					return decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+						if field == 1 {
+							funcIDs = append(funcIDs, v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			locations[id] = funcIDs
+			return err
+		case 5: // function
+			var id uint64
+			var name int64
+			err := decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 2:
+					name = int64(v)
+				}
+				return nil
+			})
+			functions[id] = name
+			return err
+		case 6: // string_table
+			stringTable = append(stringTable, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(stringTable)) {
+			return ""
+		}
+		return stringTable[i]
+	}
+
+	p := &profile{}
+	for _, st := range sampleTypes {
+		p.SampleTypes = append(p.SampleTypes, str(st[0])+"/"+str(st[1]))
+	}
+	for _, s := range samples {
+		ps := profileSample{Values: s.values}
+		for _, locID := range s.locationIDs {
+			for _, funcID := range locations[locID] {
+				ps.Stack = append(ps.Stack, str(functions[funcID]))
+			}
+		}
+		p.Samples = append(p.Samples, ps)
+	}
+	return p, nil
+}
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+	wire32Bit  = 5
+)
+
+var errBadProto = errors.New("bad protobuf encoding")
+
+// decodeMessage calls fn for every field of the protobuf message in data. For
+// varint and fixed size fields v holds the value, for length-delimited fields
+// b holds the payload.
+func decodeMessage(data []byte, fn func(field, wireType int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errBadProto
+		}
+		data = data[n:]
+
+		var (
+			field    = int(key >> 3)
+			wireType = int(key & 7)
+			v        uint64
+			b        []byte
+		)
+		switch wireType {
+		case wireVarint:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errBadProto
+			}
+			data = data[n:]
+		case wire64Bit:
+			if len(data) < 8 {
+				return errBadProto
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return errBadProto
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		case wire32Bit:
+			if len(data) < 4 {
+				return errBadProto
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d", errBadProto, wireType)
+		}
+		if err := fn(field, wireType, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRepeated calls fn for every value of a repeated varint field, which
+// may either be packed or not.
+func decodeRepeated(wireType int, v uint64, b []byte, fn func(uint64)) error {
+	if wireType != wireBytes {
+		fn(v)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBadProto
+		}
+		fn(v)
+		b = b[n:]
+	}
+	return nil
+}
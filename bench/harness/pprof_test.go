@@ -0,0 +1,59 @@
+package harness
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+func TestParseProfile(t *testing.T) {
+	runtime.SetBlockProfileRate(1)
+	defer runtime.SetBlockProfileRate(0)
+
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(ch)
+	}()
+	AtStackDepth(8, func() { <-ch })
+
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("block").WriteTo(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProfile(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHistogram()
+	h.Record(10 * time.Millisecond)
+	acc, err := blockProfileAccuracy(p, &WorkloadResult{Ops: 1, Latencies: h}, workloadFrame, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if acc.Samples != 1 {
+		t.Fatalf("samples: got %d, want 1", acc.Samples)
+	} else if acc.ContentionsRatio != 1 {
+		t.Errorf("contentions ratio: got %f, want 1", acc.ContentionsRatio)
+	} else if acc.DelayRatio < 0.5 || acc.DelayRatio > 1.5 {
+		t.Errorf("delay ratio: got %f, want ~1", acc.DelayRatio)
+	} else if len(acc.Stacks) != 1 {
+		t.Fatalf("stacks: got %d, want 1", len(acc.Stacks))
+	} else if st := acc.Stacks[0]; st.ContentionsRatio != 1 || !inStack(st.Stack, workloadFrame) {
+		t.Errorf("stack: got %+v", st)
+	}
+
+	// Without latencies, the contentions are still compared with the number
+	// of operations, but the delay can't be.
+	acc, err = blockProfileAccuracy(p, &WorkloadResult{Ops: 2}, workloadFrame, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if acc.ContentionsRatio != 0.5 {
+		t.Errorf("contentions ratio: got %f, want 0.5", acc.ContentionsRatio)
+	} else if !math.IsNaN(acc.DelayRatio) {
+		t.Errorf("delay ratio: got %f, want NaN", acc.DelayRatio)
+	}
+}
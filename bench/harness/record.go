@@ -0,0 +1,295 @@
+package harness
+
+import (
+	"math"
+	"time"
+)
+
+type Record struct {
+	BlockAccuracy        *ProfileAccuracy
+	Blockprofilerate     int
+	Mutexprofilefraction int
+	CPUProfileRate       int
+	CPUProfile           *CPUProfileStats
+	MemProfileRate       int
+	AllocBytes           int64
+	HeapBuckets          int
+	Bufsize              int
+	CriticalSection      time.Duration
+	CollectInterval      time.Duration
+	Collections          *Histogram
+	Depth                int
+	Duration             time.Duration
+	DurationLimit        time.Duration
+	Error                string
+	GoVersion            string
+	GoroutineDebug       int
+	Goroutines           int
+	Latencies            *Histogram
+	Mode                 string
+	IdleGoroutines       int
+	Labels               string
+	LatencySample        int
+	LockGoroutines       int
+	Ops                  int
+	OpsCompleted         int64
+	Run                  int
+	RuntimeMetrics       map[string]float64
+	Workload             string
+}
+
+// ColumnKind describes the role of a column when analyzing results.
+type ColumnKind int
+
+const (
+	// ParamColumn holds a parameter of the benchmark configuration.
+	ParamColumn ColumnKind = iota
+	// RunColumn holds the repetition number of a configuration.
+	RunColumn
+	// MetricColumn holds a measurement taken by the worker.
+	MetricColumn
+	// ErrorColumn holds the error of a failed run. Metric columns are empty
+	// for failed runs.
+	ErrorColumn
+)
+
+// ColumnType is the type of the values of a column. Values of missing
+// measurements are nil.
+type ColumnType int
+
+const (
+	// StringType columns hold string values.
+	StringType ColumnType = iota
+	// IntType columns hold int64 values.
+	IntType
+	// FloatType columns hold float64 values.
+	FloatType
+)
+
+type Column struct {
+	Name  string
+	Kind  ColumnKind
+	Type  ColumnType
+	Value func(*Record) interface{}
+}
+
+var Columns = []Column{
+	{"workload", ParamColumn, StringType, func(r *Record) interface{} {
+		return r.Workload
+	}},
+	{"goversion", ParamColumn, StringType, func(r *Record) interface{} {
+		return r.GoVersion
+	}},
+	{"mode", ParamColumn, StringType, func(r *Record) interface{} {
+		return r.Mode
+	}},
+	{"ops", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Ops)
+	}},
+	{"duration_limit_ns", ParamColumn, IntType, func(r *Record) interface{} {
+		return r.DurationLimit.Nanoseconds()
+	}},
+	{"latencysample", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.LatencySample)
+	}},
+	{"goroutines", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Goroutines)
+	}},
+	{"depth", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Depth)
+	}},
+	{"bufsize", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Bufsize)
+	}},
+	{"lockgoroutines", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.LockGoroutines)
+	}},
+	{"criticalsection_ns", ParamColumn, IntType, func(r *Record) interface{} {
+		return r.CriticalSection.Nanoseconds()
+	}},
+	{"idlegoroutines", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.IdleGoroutines)
+	}},
+	{"goroutinedebug", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.GoroutineDebug)
+	}},
+	{"collect_interval_ns", ParamColumn, IntType, func(r *Record) interface{} {
+		return r.CollectInterval.Nanoseconds()
+	}},
+	{"labels", ParamColumn, StringType, func(r *Record) interface{} {
+		return r.Labels
+	}},
+	{"blockprofilerate", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Blockprofilerate)
+	}},
+	{"mutexprofilefraction", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Mutexprofilefraction)
+	}},
+	{"cpuprofilerate", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.CPUProfileRate)
+	}},
+	{"memprofilerate", ParamColumn, IntType, func(r *Record) interface{} {
+		return int64(r.MemProfileRate)
+	}},
+	{"run", RunColumn, IntType, func(r *Record) interface{} {
+		return int64(r.Run)
+	}},
+	{"ms", MetricColumn, FloatType, func(r *Record) interface{} {
+		return r.Duration.Seconds() * 1000
+	}},
+	{"duration_ns", MetricColumn, IntType, func(r *Record) interface{} {
+		return r.Duration.Nanoseconds()
+	}},
+	{"ops_completed", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.Error != "" {
+			return nil
+		}
+		return r.OpsCompleted
+	}},
+	{"ops_per_sec", MetricColumn, FloatType, func(r *Record) interface{} {
+		if r.Error != "" || r.Duration == 0 {
+			return nil
+		}
+		return float64(r.OpsCompleted) / r.Duration.Seconds()
+	}},
+	latencyColumn("p50_ns", 0.5),
+	latencyColumn("p90_ns", 0.9),
+	latencyColumn("p99_ns", 0.99),
+	latencyColumn("p999_ns", 0.999),
+	{"max_ns", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.Latencies == nil || r.Latencies.Count() == 0 {
+			return nil
+		}
+		return r.Latencies.Max().Nanoseconds()
+	}},
+	{"block_samples", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.BlockAccuracy == nil {
+			return nil
+		}
+		return int64(r.BlockAccuracy.Samples)
+	}},
+	accuracyColumn("block_contentions_ratio", func(a *ProfileAccuracy) float64 { return a.ContentionsRatio }),
+	accuracyColumn("block_delay_ratio", func(a *ProfileAccuracy) float64 { return a.DelayRatio }),
+	{"block_stacks", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.BlockAccuracy == nil {
+			return nil
+		}
+		return int64(len(r.BlockAccuracy.Stacks))
+	}},
+	accuracyColumn("block_stack_contentions_ratio_min", func(a *ProfileAccuracy) float64 {
+		min, _ := a.contentionsRatioRange()
+		return min
+	}),
+	accuracyColumn("block_stack_contentions_ratio_max", func(a *ProfileAccuracy) float64 {
+		_, max := a.contentionsRatioRange()
+		return max
+	}),
+	{"cpu_samples", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.CPUProfile == nil {
+			return nil
+		}
+		return r.CPUProfile.Samples
+	}},
+	{"cpu_samples_lost", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.CPUProfile == nil {
+			return nil
+		}
+		return r.CPUProfile.Lost
+	}},
+	{"cpu_samples_ratio", MetricColumn, FloatType, func(r *Record) interface{} {
+		if r.CPUProfile == nil || math.IsNaN(r.CPUProfile.SamplesRatio) {
+			return nil
+		}
+		return r.CPUProfile.SamplesRatio
+	}},
+	{"alloc_mb_per_sec", MetricColumn, FloatType, func(r *Record) interface{} {
+		if r.AllocBytes == 0 || r.Duration == 0 {
+			return nil
+		}
+		return float64(r.AllocBytes) / 1e6 / r.Duration.Seconds()
+	}},
+	{"heap_buckets", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.MemProfileRate == 0 {
+			return nil
+		}
+		return int64(r.HeapBuckets)
+	}},
+	{"collections", MetricColumn, IntType, func(r *Record) interface{} {
+		if r.Collections == nil {
+			return nil
+		}
+		return int64(r.Collections.Count())
+	}},
+	collectionColumn("collect_p50_ns", func(h *Histogram) time.Duration { return h.Quantile(0.5) }),
+	collectionColumn("collect_max_ns", func(h *Histogram) time.Duration { return h.Max() }),
+	{"error", ErrorColumn, StringType, func(r *Record) interface{} {
+		return r.Error
+	}},
+}
+
+// latencyColumn returns a column for the given quantile of the per-operation
+// latencies, which is empty if no latencies were recorded.
+func latencyColumn(name string, q float64) Column {
+	return Column{name, MetricColumn, IntType, func(r *Record) interface{} {
+		if r.Latencies == nil || r.Latencies.Count() == 0 {
+			return nil
+		}
+		return r.Latencies.Quantile(q).Nanoseconds()
+	}}
+}
+
+// collectionColumn returns a column for a statistic of the durations of the
+// profile collections.
+func collectionColumn(name string, stat func(*Histogram) time.Duration) Column {
+	return Column{name, MetricColumn, IntType, func(r *Record) interface{} {
+		if r.Collections == nil || r.Collections.Count() == 0 {
+			return nil
+		}
+		return stat(r.Collections).Nanoseconds()
+	}}
+}
+
+// accuracyColumn returns a column for a ratio of the block profile accuracy.
+func accuracyColumn(name string, ratio func(*ProfileAccuracy) float64) Column {
+	return Column{name, MetricColumn, FloatType, func(r *Record) interface{} {
+		if r.BlockAccuracy == nil || math.IsNaN(ratio(r.BlockAccuracy)) {
+			return nil
+		}
+		return ratio(r.BlockAccuracy)
+	}}
+}
+
+// Values returns the value of every column in Columns for r.
+func (r *Record) Values() []interface{} {
+	values := make([]interface{}, len(Columns))
+	for i, col := range Columns {
+		if r.Error != "" && col.Kind == MetricColumn {
+			continue
+		}
+		values[i] = col.Value(r)
+	}
+	return values
+}
+
+func Headers() []string {
+	headers := make([]string, len(Columns))
+	for i, col := range Columns {
+		headers[i] = col.Name
+	}
+	return headers
+}
+
+// ColumnKindOf returns the kind of the column with the given name. Unknown
+// columns, e.g. from CSV files produced by older versions, are considered to
+// be parameters.
+func ColumnKindOf(name string) ColumnKind {
+	for _, col := range Columns {
+		if col.Name == name {
+			return col.Kind
+		}
+	}
+	if _, ok := lookupRuntimeMetric(name); ok {
+		return MetricColumn
+	}
+	return ParamColumn
+}
@@ -0,0 +1,372 @@
+package harness
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reportParams are the parameters that are used as the x-axis of a chart if
+// they have more than one value. All profiler rates and labels are included.
+var reportParams = append(append([]string{}, baselineParams...), "depth", "goroutines")
+
+func report(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags] <results.csv>\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Renders the overhead of every configuration as a self-contained HTML page.\n\n")
+		fs.PrintDefaults()
+	}
+	var (
+		metric = fs.String("metric", "", "The metric column to chart. Defaults to ops_per_sec if any workload ran for a -duration, ms otherwise.")
+		out    = fs.String("o", "", "Path to the HTML file to write. Defaults to stdout.")
+	)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("report: expected 1 file, got %d", fs.NArg())
+	}
+	rs, err := readResultSet(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *metric == "" {
+		*metric = rs.defaultMetric()
+	}
+	charts := overheadCharts(rs, *metric)
+	if len(charts) == 0 {
+		return fmt.Errorf("report: %s: none of %s has more than one value", fs.Arg(0), strings.Join(reportParams, ", "))
+	}
+
+	if *out == "" {
+		return writeReport(os.Stdout, fs.Arg(0), rs, charts)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeReport(f, fs.Arg(0), rs, charts); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// chart is a line chart of the overhead of a metric as a function of a
+// parameter.
+type chart struct {
+	Title  string
+	Metric string
+	// XLabel is the name of the parameter on the x-axis.
+	XLabel string
+	// XValues holds the values of the parameter in ascending order. They are
+	// spaced evenly, as most parameters are swept exponentially and include
+	// 0.
+	XValues []string
+	Series  []*chartSeries
+}
+
+// chartSeries holds the points of all configurations that only differ in the
+// parameter on the x-axis.
+type chartSeries struct {
+	Name   string
+	Points []chartPoint
+}
+
+type chartPoint struct {
+	// X is the index of the value in chart.XValues.
+	X int
+	// Y is the overhead in percent and Err the half-width of its 95%
+	// confidence interval, which is NaN if there is only a single run.
+	Y, Err float64
+}
+
+// overheadCharts returns a chart for every parameter in reportParams that has
+// more than one value in rs.
+func overheadCharts(rs *resultSet, metric string) []*chart {
+	values := make([]map[string]bool, len(rs.Params))
+	for i := range rs.Params {
+		values[i] = map[string]bool{}
+		for _, g := range rs.Groups {
+			values[i][g.Params[i]] = true
+		}
+	}
+
+	var charts []*chart
+	for _, param := range reportParams {
+		xIdx := -1
+		for i, name := range rs.Params {
+			if name == param && len(values[i]) > 1 {
+				xIdx = i
+			}
+		}
+		if xIdx == -1 {
+			continue
+		}
+
+		c := &chart{
+			Title:  fmt.Sprintf("%s overhead vs %s", metric, param),
+			Metric: metric,
+			XLabel: param,
+		}
+		for v := range values[xIdx] {
+			c.XValues = append(c.XValues, v)
+		}
+		sortParamValues(c.XValues)
+		xPos := map[string]int{}
+		for i, v := range c.XValues {
+			xPos[v] = i
+		}
+
+		bySeries := map[string]*chartSeries{}
+		for _, g := range rs.Groups {
+			base := rs.baseline(g)
+			vals := g.Metrics[metric]
+			if base == nil || len(vals) == 0 || len(base.Metrics[metric]) == 0 {
+				continue
+			}
+			baseMean := mean(base.Metrics[metric])
+
+			// Series are identified by the values of all other parameters
+			// that vary within the file.
+			var name []string
+			for i, p := range rs.Params {
+				if i != xIdx && len(values[i]) > 1 {
+					name = append(name, p+"="+g.Params[i])
+				}
+			}
+			key := strings.Join(name, " ")
+			s, ok := bySeries[key]
+			if !ok {
+				s = &chartSeries{Name: key}
+				bySeries[key] = s
+				c.Series = append(c.Series, s)
+			}
+			s.Points = append(s.Points, chartPoint{
+				X:   xPos[g.Params[xIdx]],
+				Y:   overhead(metric, vals, base.Metrics[metric]),
+				Err: confidenceInterval(vals) / baseMean * 100,
+			})
+		}
+
+		// Drop series that only contain baselines, e.g. blockprofilerate=0
+		// in a chart of the overhead vs depth.
+		series := c.Series[:0]
+		for _, s := range c.Series {
+			sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].X < s.Points[j].X })
+			for _, p := range s.Points {
+				if p.Y != 0 {
+					series = append(series, s)
+					break
+				}
+			}
+		}
+		c.Series = series
+		if len(c.Series) > 0 {
+			charts = append(charts, c)
+		}
+	}
+	return charts
+}
+
+// sortParamValues sorts vals numerically, or lexically if they are not all
+// numbers.
+func sortParamValues(vals []string) {
+	nums := make(map[string]float64, len(vals))
+	for _, v := range vals {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			sort.Strings(vals)
+			return
+		}
+		nums[v] = f
+	}
+	sort.Slice(vals, func(i, j int) bool { return nums[vals[i]] < nums[vals[j]] })
+}
+
+// chartColors is the palette used for the series of a chart.
+var chartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+func seriesColor(i int) string {
+	return chartColors[i%len(chartColors)]
+}
+
+// Dimensions of the rendered charts in pixels.
+const (
+	chartWidth   = 720
+	chartHeight  = 400
+	chartLeft    = 70
+	chartRight   = 20
+	chartTop     = 20
+	chartBottom  = 50
+	chartTickLen = 5
+)
+
+// renderChart returns c as an inline SVG element.
+func renderChart(c *chart) template.HTML {
+	lo, hi := 0.0, 0.0
+	for _, s := range c.Series {
+		for _, p := range s.Points {
+			err := p.Err
+			if math.IsNaN(err) {
+				err = 0
+			}
+			lo, hi = math.Min(lo, p.Y-err), math.Max(hi, p.Y+err)
+		}
+	}
+	step := niceStep((hi - lo) / 5)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	if hi == lo {
+		hi = lo + step
+	}
+
+	plotW := float64(chartWidth - chartLeft - chartRight)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	x := func(i int) float64 {
+		return chartLeft + (float64(i)+0.5)*plotW/float64(len(c.XValues))
+	}
+	y := func(v float64) float64 {
+		return chartTop + (hi-v)/(hi-lo)*plotH
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", chartWidth, chartHeight)
+
+	// Axes, grid lines and labels.
+	decimals := int(math.Max(0, -math.Floor(math.Log10(step))))
+	for k := 0; lo+float64(k)*step <= hi+step/2; k++ {
+		v := lo + float64(k)*step
+		fmt.Fprintf(buf, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="%s"/>`+"\n", chartLeft, y(v), chartWidth-chartRight, y(v), gridColor(v))
+		fmt.Fprintf(buf, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%.*f%%</text>`+"\n", chartLeft-chartTickLen-2, y(v), decimals, v)
+	}
+	for i, v := range c.XValues {
+		fmt.Fprintf(buf, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#000"/>`+"\n", x(i), chartHeight-chartBottom, x(i), chartHeight-chartBottom+chartTickLen)
+		fmt.Fprintf(buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", x(i), chartHeight-chartBottom+chartTickLen+14, html.EscapeString(v))
+	}
+	fmt.Fprintf(buf, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", chartLeft+plotW/2, chartHeight-8, html.EscapeString(c.XLabel))
+	fmt.Fprintf(buf, `<text transform="translate(14 %.1f) rotate(-90)" text-anchor="middle">%s overhead</text>`+"\n", chartTop+plotH/2, html.EscapeString(c.Metric))
+
+	// Series with error bars.
+	for i, s := range c.Series {
+		color := seriesColor(i)
+		var points []string
+		for _, p := range s.Points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(p.X), y(p.Y)))
+		}
+		fmt.Fprintf(buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", strings.Join(points, " "), color)
+		for _, p := range s.Points {
+			label := fmt.Sprintf("%s %s=%s: %+.2f%%", s.Name, c.XLabel, c.XValues[p.X], p.Y)
+			if !math.IsNaN(p.Err) {
+				fmt.Fprintf(buf, `<path d="M%.1f %.1fV%.1fM%.1f %.1fh8M%.1f %.1fh8" stroke="%s"/>`+"\n",
+					x(p.X), y(p.Y-p.Err), y(p.Y+p.Err),
+					x(p.X)-4, y(p.Y-p.Err),
+					x(p.X)-4, y(p.Y+p.Err),
+					color,
+				)
+				label += fmt.Sprintf(" ±%.2f%%", p.Err)
+			}
+			fmt.Fprintf(buf, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s</title></circle>`+"\n", x(p.X), y(p.Y), color, html.EscapeString(label))
+		}
+	}
+	buf.WriteString("</svg>")
+	return template.HTML(buf.String())
+}
+
+// gridColor highlights the grid line at 0% overhead.
+func gridColor(v float64) string {
+	if math.Abs(v) < 1e-9 {
+		return "#000"
+	}
+	return "#ddd"
+}
+
+// niceStep returns a round number close to x for use as the distance between
+// axis ticks.
+func niceStep(x float64) float64 {
+	if x <= 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(x)))
+	switch f := x / exp; {
+	case f < 1.5:
+		return exp
+	case f < 3:
+		return 2 * exp
+	case f < 7:
+		return 5 * exp
+	default:
+		return 10 * exp
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.env { border-collapse: collapse; font-size: small; }
+table.env th, table.env td { text-align: left; padding: 2px 8px; border-bottom: 1px solid #eee; }
+ul.legend { list-style: none; padding: 0; font-size: small; }
+ul.legend span { display: inline-block; width: 12px; height: 12px; margin-right: 6px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Overhead relative to the same configuration with the profilers disabled. Error bars show the 95% confidence interval of the mean of the repeated runs.</p>
+{{if .Env}}<table class="env">
+{{range .Env}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>{{end}}
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+{{.SVG}}
+<ul class="legend">
+{{range .Legend}}<li><span style="background: {{.Color}}"></span>{{.Name}}</li>
+{{end}}</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// writeReport writes the HTML page for the given charts to w.
+func writeReport(w io.Writer, title string, rs *resultSet, charts []*chart) error {
+	type legendEntry struct {
+		Name  string
+		Color template.CSS
+	}
+	type renderedChart struct {
+		Title  string
+		SVG    template.HTML
+		Legend []legendEntry
+	}
+	data := struct {
+		Title  string
+		Env    Environment
+		Charts []renderedChart
+	}{Title: title, Env: rs.Env}
+	for _, c := range charts {
+		rc := renderedChart{Title: c.Title, SVG: renderChart(c)}
+		for i, s := range c.Series {
+			name := s.Name
+			if name == "" {
+				name = c.Metric
+			}
+			rc.Legend = append(rc.Legend, legendEntry{name, template.CSS(seriesColor(i))})
+		}
+		data.Charts = append(data.Charts, rc)
+	}
+	return reportTemplate.Execute(w, data)
+}
@@ -0,0 +1,53 @@
+package harness
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOverheadCharts(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`workload,depth,blockprofilerate,run,ms
+mutex,4,0,1,10
+mutex,4,0,2,10
+mutex,4,100,1,11
+mutex,4,100,2,13
+mutex,16,0,1,20
+mutex,16,0,2,20
+mutex,16,100,1,30
+mutex,16,100,2,30
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	charts := overheadCharts(rs, "ms")
+	if got, want := len(charts), 2; got != want {
+		t.Fatalf("charts: got %d, want %d", got, want)
+	}
+
+	rate := charts[0]
+	if got, want := rate.XLabel, "blockprofilerate"; got != want {
+		t.Errorf("xlabel: got %q, want %q", got, want)
+	} else if got, want := len(rate.Series), 2; got != want {
+		t.Fatalf("series: got %d, want %d", got, want)
+	} else if got, want := rate.Series[1].Name, "depth=16"; got != want {
+		t.Errorf("series name: got %q, want %q", got, want)
+	} else if got, want := rate.Series[1].Points[1].Y, 50.0; got != want {
+		t.Errorf("overhead: got %v, want %v", got, want)
+	}
+
+	// The blockprofilerate=0 series only contains baselines.
+	depth := charts[1]
+	if got, want := len(depth.Series), 1; got != want {
+		t.Fatalf("series: got %d, want %d", got, want)
+	} else if got, want := depth.Series[0].Points[0].Y, 20.0; got != want {
+		t.Errorf("overhead: got %v, want %v", got, want)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeReport(buf, "test", rs, charts); err != nil {
+		t.Fatal(err)
+	} else if got, want := strings.Count(buf.String(), "<svg"), 2; got != want {
+		t.Errorf("svg elements: got %d, want %d", got, want)
+	}
+}
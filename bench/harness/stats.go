@@ -0,0 +1,194 @@
+package harness
+
+import (
+	"math"
+	"sort"
+)
+
+// mean returns the arithmetic mean of xs.
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// stddev returns the sample standard deviation of xs.
+func stddev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	m := mean(xs)
+	var sum float64
+	for _, x := range xs {
+		sum += (x - m) * (x - m)
+	}
+	return math.Sqrt(sum / float64(len(xs)-1))
+}
+
+// confidenceInterval returns the half-width of the 95% confidence interval
+// for the mean of xs, assuming that xs is normally distributed.
+func confidenceInterval(xs []float64) float64 {
+	if len(xs) < 2 {
+		return math.NaN()
+	}
+	return tQuantile95(len(xs)-1) * stddev(xs) / math.Sqrt(float64(len(xs)))
+}
+
+// tTable95 holds the two-sided 95% quantiles of Student's t-distribution for
+// 1 to 30 degrees of freedom.
+var tTable95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile95 returns the two-sided 95% quantile of Student's t-distribution
+// with df degrees of freedom. Values beyond the table are approximated using a
+// Cornish-Fisher expansion around the normal quantile.
+func tQuantile95(df int) float64 {
+	if df <= len(tTable95) {
+		return tTable95[df-1]
+	}
+	z := 1.959964
+	n := float64(df)
+	return z + (z*z*z+z)/(4*n) + (5*math.Pow(z, 5)+16*z*z*z+3*z)/(96*n*n)
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test for
+// the null hypothesis that a and b are drawn from the same distribution. This
+// is the same test used by benchstat. The exact distribution of U is used for
+// small samples without ties, otherwise the normal approximation with tie
+// correction is used.
+func mannWhitneyU(a, b []float64) float64 {
+	lower, upper := mannWhitneyTails(a, b)
+	return math.Min(1, 2*math.Min(lower, upper))
+}
+
+// mannWhitneyUGreater is like mannWhitneyU, but returns the one-sided p-value
+// for the alternative hypothesis that a tends to be greater than b.
+func mannWhitneyUGreater(a, b []float64) float64 {
+	_, upper := mannWhitneyTails(a, b)
+	return upper
+}
+
+// mannWhitneyMinP returns the smallest one-sided p-value mannWhitneyUGreater
+// can return for samples of size n1 and n2 without ties, i.e. when all values
+// of a are greater than all values of b.
+func mannWhitneyMinP(n1, n2 int) float64 {
+	// There are n1+n2 choose n1 equally likely arrangements of the ranks, and
+	// only one of them is as extreme.
+	arrangements := 1.0
+	for i := 1; i <= n1; i++ {
+		arrangements = arrangements * float64(n2+i) / float64(i)
+	}
+	return 1 / arrangements
+}
+
+// mannWhitneyTails returns the probabilities of observing a U statistic at
+// least as small and at least as large as the one of a and b under the null
+// hypothesis, or NaN if either of them is empty.
+func mannWhitneyTails(a, b []float64) (lower, upper float64) {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return math.NaN(), math.NaN()
+	}
+
+	type obs struct {
+		v     float64
+		group int
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, obs{v, 0})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, 1})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Assign ranks, using the average rank for ties.
+	var (
+		rankSumA float64
+		tieTerm  float64
+		ties     bool
+	)
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].group == 0 {
+				rankSumA += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSumA - float64(n1*(n1+1))/2
+
+	if !ties && n1+n2 <= 50 {
+		return mannWhitneyExact(n1, n2, u)
+	}
+
+	n := float64(n1 + n2)
+	mu := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return 1, 1
+	}
+	// The continuity correction moves u half a step towards the mean.
+	tail := func(z float64) float64 { return math.Min(1, 0.5*math.Erfc(z/math.Sqrt2)) }
+	return tail((mu - u - 0.5) / sigma), tail((u - mu - 0.5) / sigma)
+}
+
+// mannWhitneyExact returns the exact probabilities of observing a statistic
+// at least as small and at least as large as u with sample sizes n1 and n2 in
+// the absence of ties.
+func mannWhitneyExact(n1, n2 int, u float64) (lower, upper float64) {
+	// counts[i][j][k] is the number of arrangements of i a's and j b's with
+	// U=k. Only two rows of i are kept in memory at once.
+	maxU := n1 * n2
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		for j := range cur {
+			cur[j] = make([]float64, maxU+1)
+			for k := 0; k <= maxU; k++ {
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				if j > 0 {
+					cur[j][k] += cur[j-1][k]
+				}
+			}
+		}
+		prev = cur
+	}
+	dist := prev[n2]
+
+	var total float64
+	for k, c := range dist {
+		total += c
+		if float64(k) <= u {
+			lower += c
+		}
+		if float64(k) >= u {
+			upper += c
+		}
+	}
+	return lower / total, upper / total
+}
@@ -0,0 +1,86 @@
+package harness
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMeanStddev(t *testing.T) {
+	xs := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	if got, want := mean(xs), 5.0; got != want {
+		t.Errorf("mean: got %v, want %v", got, want)
+	}
+	if got, want := stddev(xs), 2.138; math.Abs(got-want) > 0.001 {
+		t.Errorf("stddev: got %v, want %v", got, want)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		a, b []float64
+		want float64
+	}{
+		// Completely separated samples of size 3 can be arranged in 20 ways,
+		// two of which are as extreme as this one.
+		{[]float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{[]float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+	}
+	for _, test := range tests {
+		if got := mannWhitneyU(test.a, test.b); math.Abs(got-test.want) > 0.001 {
+			t.Errorf("mannWhitneyU(%v, %v): got %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestMannWhitneyUGreater(t *testing.T) {
+	tests := []struct {
+		a, b []float64
+		want float64
+	}{
+		// Only one of the 20 arrangements is as extreme as this one.
+		{[]float64{4, 5, 6}, []float64{1, 2, 3}, 0.05},
+		{[]float64{1, 2, 3}, []float64{4, 5, 6}, 1},
+		{[]float64{2, 4, 6}, []float64{1, 3, 5}, 0.35},
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+	}
+	for _, test := range tests {
+		if got := mannWhitneyUGreater(test.a, test.b); math.Abs(got-test.want) > 0.001 {
+			t.Errorf("mannWhitneyUGreater(%v, %v): got %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	if got, want := mannWhitneyMinP(3, 3), 0.05; math.Abs(got-want) > 1e-9 {
+		t.Errorf("mannWhitneyMinP(3, 3): got %v, want %v", got, want)
+	} else if got, want := mannWhitneyMinP(2, 2), 1.0/6; math.Abs(got-want) > 1e-9 {
+		t.Errorf("mannWhitneyMinP(2, 2): got %v, want %v", got, want)
+	}
+}
+
+func TestParseResultSet(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`# go_version: go1.16
+# num_cpu: 8
+workload,blockprofilerate,memprofilerate,run,ms
+mutex,0,524288,1,10
+mutex,0,524288,2,12
+mutex,1,524288,1,15
+mutex,1,524288,2,15
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rs.Env.Get("num_cpu"), "8"; got != want {
+		t.Errorf("num_cpu: got %q, want %q", got, want)
+	}
+	if got, want := len(rs.Groups), 2; got != want {
+		t.Fatalf("groups: got %d, want %d", got, want)
+	}
+	g := rs.Groups[1]
+	if base := rs.baseline(g); base != rs.Groups[0] {
+		t.Fatalf("baseline: got %v, want %v", base, rs.Groups[0])
+	} else if got, want := mean(g.Metrics["ms"])/mean(base.Metrics["ms"]), 15.0/11; got != want {
+		t.Errorf("ratio: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,337 @@
+package harness
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// baselineParams are the parameters that disable a profiler when set to 0,
+// or, for labels, stop setting pprof labels when set to none. Overheads are
+// computed relative to the configuration that has all of them disabled, so
+// the overhead of labels=8 with all profilers disabled is the cost of the
+// labels alone. Parameters that are never disabled in a file, e.g.
+// memprofilerate when only the default rate was used, keep their value.
+var baselineParams = []string{"blockprofilerate", "mutexprofilefraction", "cpuprofilerate", "memprofilerate", "collect_interval_ns", "labels"}
+
+// disabledValue returns the value that disables the baseline param name.
+func disabledValue(name string) string {
+	if name == "labels" {
+		return "none"
+	}
+	return "0"
+}
+
+// collectingParams only apply to configurations that collect profiles in the
+// background, i.e. have a non-zero collect_interval_ns. The configurations
+// that don't collect have them set to 0, so they are reset along with
+// collect_interval_ns when looking up a baseline.
+var collectingParams = []string{"goroutinedebug"}
+
+// higherIsBetter contains the metrics for which larger values are better,
+// e.g. throughput. Their overhead is the relative decrease instead of the
+// increase, so a positive overhead always means that the profiler made things
+// worse.
+var higherIsBetter = map[string]bool{"ops_per_sec": true, "alloc_mb_per_sec": true}
+
+// overhead returns the overhead of vals relative to base in percent.
+func overhead(metric string, vals, base []float64) float64 {
+	baseMean := mean(base)
+	o := (mean(vals) - baseMean) / baseMean * 100
+	if higherIsBetter[metric] {
+		return -o
+	}
+	return o
+}
+
+func summarize(args []string) error {
+	fs := flag.NewFlagSet("summarize", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s summarize [flags] <results.csv> [<new-results.csv>]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Summarizes the results of a single file, or compares two files with each other.\n\n")
+		fs.PrintDefaults()
+	}
+	var (
+		metric = fs.String("metric", "", "The metric column to analyze. Defaults to ops_per_sec if any workload ran for a -duration, ms otherwise.")
+		alpha  = fs.Float64("alpha", 0.05, "The significance level used when comparing two files.")
+		mixEnv = fs.Bool("mixenv", false, "Compare files even if they were produced in different environments.")
+	)
+	fs.Parse(args)
+
+	switch fs.NArg() {
+	case 1:
+		rs, err := readResultSet(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *metric == "" {
+			*metric = rs.defaultMetric()
+		}
+		return printSummary(os.Stdout, rs, *metric)
+	case 2:
+		old, err := readResultSet(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		new, err := readResultSet(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		// Files without an environment header might or might not have been
+		// produced in the same environment, so they are not refused.
+		if old.Env == nil || new.Env == nil {
+			fmt.Fprintf(os.Stderr, "warning: can't check if the files were produced in the same environment: at least one of them has no environment header\n")
+		} else if diffs := old.Env.Diff(new.Env); len(diffs) > 0 {
+			msg := "the files were produced in different environments:\n  " + strings.Join(diffs, "\n  ")
+			if !*mixEnv {
+				return fmt.Errorf("summarize: %s\nuse -mixenv to compare them anyway", msg)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s\n", msg)
+		}
+		if *metric == "" {
+			*metric = old.defaultMetric()
+		}
+		return printComparison(os.Stdout, old, new, *metric, *alpha)
+	default:
+		fs.Usage()
+		return fmt.Errorf("summarize: expected 1 or 2 files, got %d", fs.NArg())
+	}
+}
+
+// resultSet holds the results of a CSV file grouped by configuration, i.e.
+// all rows that only differ in their run and metric columns.
+type resultSet struct {
+	// Env is the environment fingerprint found in the header of the file, or
+	// nil if it has none.
+	Env Environment
+	// Params are the names of the parameter columns.
+	Params []string
+	// Groups contains the groups in the order of their first appearance.
+	Groups []*resultGroup
+
+	byKey map[string]*resultGroup
+	// disabled contains the indexes of the params that have their
+	// disabledValue in any group.
+	disabled map[int]bool
+}
+
+type resultGroup struct {
+	// Params holds the value of every parameter column.
+	Params []string
+	// Metrics maps metric column names to the values of all runs.
+	Metrics map[string][]float64
+}
+
+func (g *resultGroup) key() string {
+	return strings.Join(g.Params, ",")
+}
+
+func readResultSet(path string) (*resultSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rs, err := parseResultSet(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rs, nil
+}
+
+func parseResultSet(r io.Reader) (*resultSet, error) {
+	br := bufio.NewReader(r)
+	env, err := readEnvHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(br)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &resultSet{Env: env, byKey: map[string]*resultGroup{}, disabled: map[int]bool{}}
+	var paramIdx, metricIdx, errorIdx []int
+	for i, name := range header {
+		switch ColumnKindOf(name) {
+		case ParamColumn:
+			rs.Params = append(rs.Params, name)
+			paramIdx = append(paramIdx, i)
+		case MetricColumn:
+			metricIdx = append(metricIdx, i)
+		case ErrorColumn:
+			errorIdx = append(errorIdx, i)
+		}
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		} else if failed(row, errorIdx) {
+			continue
+		}
+
+		g := &resultGroup{Params: make([]string, len(paramIdx))}
+		for i, idx := range paramIdx {
+			g.Params[i] = row[idx]
+			if row[idx] == disabledValue(rs.Params[i]) {
+				rs.disabled[i] = true
+			}
+		}
+		if existing, ok := rs.byKey[g.key()]; ok {
+			g = existing
+		} else {
+			g.Metrics = map[string][]float64{}
+			rs.byKey[g.key()] = g
+			rs.Groups = append(rs.Groups, g)
+		}
+
+		for _, idx := range metricIdx {
+			if row[idx] == "" {
+				continue
+			}
+			val, err := strconv.ParseFloat(row[idx], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s value: %w", header[idx], err)
+			}
+			g.Metrics[header[idx]] = append(g.Metrics[header[idx]], val)
+		}
+	}
+	return rs, nil
+}
+
+// failed returns true if any of the error columns of row is non-empty.
+func failed(row []string, errorIdx []int) bool {
+	for _, idx := range errorIdx {
+		if row[idx] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMetric returns the metric to analyze if none was given. It's
+// ops_per_sec if any workload ran for a fixed duration, as its ms are roughly
+// constant, and ms otherwise.
+func (rs *resultSet) defaultMetric() string {
+	for i, name := range rs.Params {
+		if name != "mode" {
+			continue
+		}
+		for _, g := range rs.Groups {
+			if g.Params[i] == ModeDuration {
+				return "ops_per_sec"
+			}
+		}
+	}
+	return "ms"
+}
+
+// baseline returns the group with the same params as g but all profilers and
+// labels disabled, or nil if there is no such group.
+func (rs *resultSet) baseline(g *resultGroup) *resultGroup {
+	params := make([]string, len(g.Params))
+	copy(params, g.Params)
+	collecting := true
+	for i, name := range rs.Params {
+		for _, baselineParam := range baselineParams {
+			if name == baselineParam && rs.disabled[i] {
+				params[i] = disabledValue(name)
+				if name == "collect_interval_ns" {
+					collecting = false
+				}
+			}
+		}
+	}
+	if !collecting {
+		for i, name := range rs.Params {
+			for _, collectingParam := range collectingParams {
+				if name == collectingParam {
+					params[i] = "0"
+				}
+			}
+		}
+	}
+	return rs.byKey[strings.Join(params, ",")]
+}
+
+func printSummary(w io.Writer, rs *resultSet, metric string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	header := append(append([]string{}, rs.Params...), "n", metric, "stddev", "ci95", "overhead")
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	for _, g := range rs.Groups {
+		vals := g.Metrics[metric]
+		o := "-"
+		if base := rs.baseline(g); base != nil && len(base.Metrics[metric]) > 0 {
+			o = fmt.Sprintf("%+.2f%%", overhead(metric, vals, base.Metrics[metric]))
+		}
+		row := append(append([]string{}, g.Params...),
+			fmt.Sprintf("%d", len(vals)),
+			formatFloat(mean(vals)),
+			formatFloat(stddev(vals)),
+			"±"+formatFloat(confidenceInterval(vals)),
+			o,
+		)
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func printComparison(w io.Writer, old, new *resultSet, metric string, alpha float64) error {
+	if strings.Join(old.Params, ",") != strings.Join(new.Params, ",") {
+		return fmt.Errorf("summarize: incompatible columns: %v vs %v", old.Params, new.Params)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	header := append(append([]string{}, old.Params...), "old "+metric, "new "+metric, "delta")
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	for _, oldGroup := range old.Groups {
+		newGroup, ok := new.byKey[oldGroup.key()]
+		if !ok {
+			continue
+		}
+		oldVals, newVals := oldGroup.Metrics[metric], newGroup.Metrics[metric]
+		oldMean, newMean := mean(oldVals), mean(newVals)
+
+		p := mannWhitneyU(oldVals, newVals)
+		delta := "~"
+		if p < alpha {
+			delta = fmt.Sprintf("%+.2f%%", (newMean-oldMean)/oldMean*100)
+		}
+		delta += fmt.Sprintf(" (p=%.3f n=%d+%d)", p, len(oldVals), len(newVals))
+
+		row := append(append([]string{}, oldGroup.Params...),
+			formatMeanStddev(oldVals),
+			formatMeanStddev(newVals),
+			delta,
+		)
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func formatMeanStddev(vals []float64) string {
+	m := mean(vals)
+	return fmt.Sprintf("%s ±%.0f%%", formatFloat(m), stddev(vals)/m*100)
+}
+
+func formatFloat(f float64) string {
+	if math.IsNaN(f) {
+		return "-"
+	}
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
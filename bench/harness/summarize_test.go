@@ -0,0 +1,77 @@
+package harness
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`workload,goroutinedebug,collect_interval_ns,blockprofilerate,run,ms
+goroutineprofile,0,0,0,1,10
+goroutineprofile,0,0,0,2,10
+goroutineprofile,0,0,0,3,10
+goroutineprofile,1,1000000,0,1,12
+goroutineprofile,1,1000000,0,2,12
+goroutineprofile,1,1000000,0,3,12
+goroutineprofile,2,1000000,0,1,15
+goroutineprofile,2,1000000,0,2,15
+goroutineprofile,2,1000000,0,3,15
+goroutineprofile,0,0,100,1,11
+goroutineprofile,0,0,100,2,11
+goroutineprofile,0,0,100,3,11
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := rs.Groups[0]
+	for _, g := range rs.Groups {
+		if got := rs.baseline(g); got != base {
+			t.Errorf("%s: got baseline %v, want %s", g.key(), got, base.key())
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := printSummary(buf, rs, "ms"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+20.00%", "+50.00%", "+10.00%"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("summary is missing %s overhead:\n%s", want, buf.String())
+		}
+	}
+
+	b, err := parseBudget("goroutineprofile, goroutinedebug=2: max 60% overhead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := checkBudgets(rs, []*budget{b}, "ms", 0.05)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	} else if results[0].Err != "" {
+		t.Errorf("got error %q", results[0].Err)
+	}
+}
+
+func TestBaselineLabels(t *testing.T) {
+	rs, err := parseResultSet(strings.NewReader(`workload,labels,cpuprofilerate,run,ms
+labels,none,0,1,10
+labels,8,0,1,12
+labels,none,100,1,11
+labels,8,100,1,13
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := rs.Groups[0]
+	for _, g := range rs.Groups {
+		if got := rs.baseline(g); got != base {
+			t.Errorf("%s: got baseline %v, want %s", g.key(), got, base.key())
+		}
+	}
+	if got, want := overhead("ms", rs.Groups[1].Metrics["ms"], base.Metrics["ms"]), 20.0; got != want {
+		t.Errorf("labels overhead: got %v, want %v", got, want)
+	}
+}
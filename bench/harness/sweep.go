@@ -0,0 +1,301 @@
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Failure policies for worker runs that keep failing after all retries.
+const (
+	OnFailureSkip  = "skip"
+	OnFailureAbort = "abort"
+)
+
+// Sweep runs the worker process for a list of configurations and writes the
+// resulting rows to Out in the order of the configurations, regardless of the
+// order in which they complete.
+type Sweep struct {
+	// Configs holds the parameters of every worker run.
+	Configs []*Record
+	// WorkerArgs are passed to every worker in addition to the config.
+	WorkerArgs []string
+	// Binaries maps Go versions to the worker binary built with them. Configs
+	// with a GoVersion not found in Binaries are run with os.Args[0].
+	Binaries map[string]string
+	// Parallel is the number of worker processes to run at the same time.
+	Parallel int
+	// Pin causes every worker process to be pinned to its own set of CPUs.
+	Pin bool
+	// Retries is the number of times a failed worker run is repeated.
+	Retries int
+	// OnFailure is OnFailureSkip or OnFailureAbort.
+	OnFailure string
+	// Checkpoint is the path of a file recording completed runs, or "".
+	Checkpoint string
+	// Out receives the result rows.
+	Out ResultWriter
+
+	checkpointMu sync.Mutex
+	checkpointW  io.Writer
+}
+
+// checkpointEntry is a single line in the checkpoint file. Row holds the
+// output of the worker, see decodeJSONRow.
+type checkpointEntry struct {
+	Key string `json:"key"`
+	Row string `json:"row"`
+}
+
+type sweepResult struct {
+	row []interface{}
+	err error
+}
+
+// Run runs all configs and returns after their rows have been written to
+// Out. Out is not closed.
+func (s *Sweep) Run() error {
+	if s.Parallel < 1 {
+		return fmt.Errorf("bad parallel: %d: must be >= 1", s.Parallel)
+	} else if s.OnFailure != OnFailureSkip && s.OnFailure != OnFailureAbort {
+		return fmt.Errorf("bad onfailure: %q: must be %q or %q", s.OnFailure, OnFailureSkip, OnFailureAbort)
+	}
+
+	var cpuSlots [][]int
+	if s.Pin {
+		cpus, err := allowedCPUs()
+		if err != nil {
+			return err
+		}
+		if cpuSlots, err = splitCPUs(cpus, s.Parallel); err != nil {
+			return err
+		}
+	}
+
+	completed := map[string][]interface{}{}
+	if s.Checkpoint != "" {
+		var err error
+		if completed, err = readCheckpoint(s.Checkpoint); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.Checkpoint, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		s.checkpointW = f
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]chan sweepResult, len(s.Configs))
+	for i := range results {
+		results[i] = make(chan sweepResult, 1)
+	}
+
+	jobs := make(chan int)
+	for slot := 0; slot < s.Parallel; slot++ {
+		var cpus []int
+		if cpuSlots != nil {
+			cpus = cpuSlots[slot]
+		}
+		go func() {
+			for i := range jobs {
+				row, err := s.runConfig(ctx, s.Configs[i], cpus)
+				results[i] <- sweepResult{row, err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i, config := range s.Configs {
+			if row, ok := completed[s.checkpointKey(config)]; ok {
+				results[i] <- sweepResult{row: row}
+				continue
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for _, result := range results {
+		res := <-result
+		if res.err != nil {
+			return res.err
+		}
+		if err := s.Out.WriteRow(res.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runConfig runs the worker for the given config and returns the row it
+// produced. If all attempts fail, a row describing the error is returned when
+// OnFailure is OnFailureSkip.
+func (s *Sweep) runConfig(ctx context.Context, config *Record, cpus []int) ([]interface{}, error) {
+	args := s.workerArgs(config)
+	if len(cpus) > 0 {
+		args = append(args, "-cpus", joinInts(cpus))
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= s.Retries+1; attempt++ {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd := exec.CommandContext(ctx, s.binary(config), args...)
+		cmd.Stdout = stdout
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+		cmd.Env = append(cmd.Env, workerEnv+"=yeah")
+
+		err := cmd.Run()
+		if err == nil {
+			var row []interface{}
+			if row, err = decodeJSONRow(stdout.Bytes()); err == nil {
+				return row, s.writeCheckpoint(config, stdout.Bytes())
+			}
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = workerError(err, stderr.String())
+	}
+
+	if s.OnFailure == OnFailureAbort {
+		return nil, fmt.Errorf("worker %s: %w", argsKey(args), lastErr)
+	}
+
+	failed := *config
+	failed.Error = fmt.Sprintf("failed after %d attempts: %s", s.Retries+1, lastErr)
+	return failed.Values(), nil
+}
+
+func (s *Sweep) writeCheckpoint(config *Record, row []byte) error {
+	if s.checkpointW == nil {
+		return nil
+	}
+	data, err := json.Marshal(checkpointEntry{Key: s.checkpointKey(config), Row: string(row)})
+	if err != nil {
+		return err
+	}
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	_, err = s.checkpointW.Write(append(data, '\n'))
+	return err
+}
+
+// checkpointKey identifies the run of config in the checkpoint file.
+func (s *Sweep) checkpointKey(config *Record) string {
+	return config.GoVersion + " " + argsKey(s.workerArgs(config))
+}
+
+// readCheckpoint returns the rows of all completed runs recorded in the
+// checkpoint file at path, keyed by their checkpointKey. A missing file is
+// treated as an empty checkpoint.
+func readCheckpoint(path string) (map[string][]interface{}, error) {
+	completed := map[string][]interface{}{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return completed, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// The last line might be truncated if the leader was killed while
+			// writing it, so ignore it and run the config again.
+			continue
+		}
+		row, err := decodeJSONRow([]byte(entry.Row))
+		if err != nil {
+			continue
+		}
+		completed[entry.Key] = row
+	}
+	return completed, scanner.Err()
+}
+
+// workerArgs returns the command line arguments for running the worker with
+// the given config.
+func (s *Sweep) workerArgs(config *Record) []string {
+	return append([]string{
+		"-run", fmt.Sprintf("%d", config.Run),
+		"-blockprofilerate", fmt.Sprintf("%d", config.Blockprofilerate),
+		"-mutexprofilefraction", fmt.Sprintf("%d", config.Mutexprofilefraction),
+		"-cpuprofilerate", fmt.Sprintf("%d", config.CPUProfileRate),
+		"-memprofilerate", fmt.Sprintf("%d", config.MemProfileRate),
+		"-ops", fmt.Sprintf("%d", config.Ops),
+		"-duration", config.DurationLimit.String(),
+		"-latencysample", fmt.Sprintf("%d", config.LatencySample),
+		"-goroutines", fmt.Sprintf("%d", config.Goroutines),
+		"-depth", fmt.Sprintf("%d", config.Depth),
+		"-bufsize", fmt.Sprintf("%d", config.Bufsize),
+		"-lockgoroutines", fmt.Sprintf("%d", config.LockGoroutines),
+		"-criticalsection", config.CriticalSection.String(),
+		"-idlegoroutines", fmt.Sprintf("%d", config.IdleGoroutines),
+		"-goroutinedebug", fmt.Sprintf("%d", config.GoroutineDebug),
+		"-collectinterval", config.CollectInterval.String(),
+		"-labels", config.Labels,
+		"-workload", config.Workload,
+		"-format", FormatJSON,
+	}, s.WorkerArgs...)
+}
+
+// binary returns the path of the worker binary for the given config.
+func (s *Sweep) binary(config *Record) string {
+	if binary, ok := s.Binaries[config.GoVersion]; ok {
+		return binary
+	}
+	return os.Args[0]
+}
+
+func argsKey(args []string) string {
+	return strings.Join(args, " ")
+}
+
+// workerError returns an error for a failed worker that includes the last line
+// the worker printed to stderr, if any.
+func workerError(err error, stderr string) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return fmt.Errorf("%w: %s", err, last)
+	}
+	return err
+}
+
+// splitCPUs divides cpus into n disjoint slots of equal size. Left over cpus
+// are not used.
+func splitCPUs(cpus []int, n int) ([][]int, error) {
+	perSlot := len(cpus) / n
+	if perSlot < 1 {
+		return nil, fmt.Errorf("can't pin %d parallel workers to %d cpus", n, len(cpus))
+	}
+	slots := make([][]int, n)
+	for i := range slots {
+		slots[i] = cpus[i*perSlot : (i+1)*perSlot]
+	}
+	return slots, nil
+}
+
+func joinInts(vals []int) string {
+	strs := make([]string, len(vals))
+	for i, val := range vals {
+		strs[i] = fmt.Sprintf("%d", val)
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,87 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// minGoMinor is the oldest Go 1.x release the worker can be built with, as
+// it uses runtime/metrics.
+const minGoMinor = 16
+
+// toolchain is a Go installation used for building the worker binary.
+type toolchain struct {
+	// GOROOT is the root directory of the installation.
+	GOROOT string
+	// Version is the version reported by the toolchain, e.g. "go1.16.5".
+	Version string
+	// Binary is the path of the worker binary built by the toolchain.
+	Binary string
+}
+
+// buildToolchains builds the worker binary from the package in the current
+// directory for every GOROOT in goroots. The binaries are placed in dir.
+func buildToolchains(goroots []string, dir string) ([]*toolchain, error) {
+	var toolchains []*toolchain
+	seen := map[string]string{}
+	for i, goroot := range goroots {
+		tc := &toolchain{GOROOT: goroot}
+		out, err := toolchainCommand(goroot, "version").Output()
+		if err != nil {
+			return nil, fmt.Errorf("toolchain %s: %w", goroot, err)
+		}
+		// Output looks like: "go version go1.16.5 linux/amd64"
+		fields := strings.Fields(string(out))
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("toolchain %s: bad version output: %q", goroot, out)
+		}
+		tc.Version = fields[2]
+		if err := checkGoVersion(tc.Version); err != nil {
+			return nil, fmt.Errorf("toolchain %s: %w", goroot, err)
+		}
+		if other, ok := seen[tc.Version]; ok {
+			return nil, fmt.Errorf("toolchains %s and %s have the same version: %s", other, goroot, tc.Version)
+		}
+		seen[tc.Version] = goroot
+
+		tc.Binary = filepath.Join(dir, fmt.Sprintf("worker-%d", i))
+		build := toolchainCommand(goroot, "build", "-o", tc.Binary, ".")
+		stderr := &bytes.Buffer{}
+		build.Stderr = stderr
+		if err := build.Run(); err != nil {
+			return nil, fmt.Errorf("toolchain %s: build: %w", goroot, workerError(err, stderr.String()))
+		}
+		toolchains = append(toolchains, tc)
+	}
+	return toolchains, nil
+}
+
+var goVersionRe = regexp.MustCompile(`^go1\.(\d+)`)
+
+// checkGoVersion returns an error if version is older than go1.16. Versions
+// that can't be parsed, e.g. "devel", are assumed to be recent enough.
+func checkGoVersion(version string) error {
+	m := goVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	if minor, _ := strconv.Atoi(m[1]); minor < minGoMinor {
+		return fmt.Errorf("%s is not supported: the worker needs go1.%d or later", version, minGoMinor)
+	}
+	return nil
+}
+
+// toolchainCommand returns a command running the go tool of the given GOROOT.
+// GOTOOLCHAIN=local prevents newer versions of the go tool from switching to
+// a different toolchain.
+func toolchainCommand(goroot string, args ...string) *exec.Cmd {
+	cmd := exec.Command(filepath.Join(goroot, "bin", "go"), args...)
+	cmd.Env = append(os.Environ(), "GOROOT="+goroot, "GOTOOLCHAIN=local")
+	return cmd
+}
@@ -0,0 +1,16 @@
+package harness
+
+import "testing"
+
+func TestCheckGoVersion(t *testing.T) {
+	for _, v := range []string{"go1.16", "go1.16.5", "go1.21rc1", "go1.27.1", "devel"} {
+		if err := checkGoVersion(v); err != nil {
+			t.Errorf("%s: %s", v, err)
+		}
+	}
+	for _, v := range []string{"go1.15", "go1.9.7", "go1.4-bootstrap"} {
+		if err := checkGoVersion(v); err == nil {
+			t.Errorf("%s: expected error", v)
+		}
+	}
+}
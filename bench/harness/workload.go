@@ -0,0 +1,180 @@
+package harness
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Workload is a benchmark scenario that can be executed by the worker.
+// Workloads make themselves available by calling RegisterWorkload from an
+// init function in their own file.
+type Workload interface {
+	// Description returns a short human readable summary of the workload.
+	Description() string
+	// Params returns the names of the optional parameters honored by the
+	// workload. Goroutines, ops and depth apply to all workloads and are not
+	// included.
+	Params() []string
+	// Run executes the workload using the given parameters.
+	Run(p WorkloadParams) (*WorkloadResult, error)
+}
+
+// ProfileFramer can be implemented by workloads whose blocking operations
+// don't happen below AtStackDepth, e.g. because they call into existing code
+// that starts its own goroutines.
+type ProfileFramer interface {
+	// ProfileFrame returns the name of a function, without its package path,
+	// that is found in the stack traces of all blocking operations of the
+	// workload. Profile samples without it are not attributed to the workload.
+	// If it returns "", all samples are attributed to the workload, including
+	// the ones of the worker waiting for it.
+	ProfileFrame() string
+}
+
+// profileFrame returns the function that identifies the profile samples of w.
+func profileFrame(w Workload) string {
+	if f, ok := w.(ProfileFramer); ok {
+		return f.ProfileFrame()
+	}
+	return workloadFrame
+}
+
+// WorkloadParams holds the parameters for a single workload execution.
+type WorkloadParams struct {
+	Goroutines int
+	Ops        int
+	Depth      int
+	Bufsize    int
+	// LockGoroutines is the number of goroutines sharing the same lock.
+	LockGoroutines int
+	// CriticalSection is the duration of simulated work performed while
+	// holding a lock.
+	CriticalSection time.Duration
+	// GoroutineDebug is the debug argument used for collecting goroutine
+	// profiles.
+	GoroutineDebug int
+	// CollectInterval is the interval at which profiles are collected, or 0
+	// for not collecting them.
+	CollectInterval time.Duration
+	// IdleGoroutines is the number of additional goroutines that stay blocked
+	// while the workload is running.
+	IdleGoroutines int
+	// Labels describes the pprof labels set by the workload: "none", "<n>"
+	// for n labels per goroutine, or "<n>/op" for n labels set for every
+	// operation using pprof.Do. Only workloads with ParamLabels set them.
+	Labels string
+	// LatencySample is the interval of operations whose latency is recorded,
+	// e.g. 1 for every operation or 100 for every 100th operation. Latencies
+	// are not recorded if it's 0.
+	LatencySample int
+	// Deadline causes the workload to perform operations until it is reached
+	// instead of performing Ops operations per goroutine, unless it is zero.
+	Deadline time.Time
+}
+
+// More returns true if the operation with the given index should be performed
+// by a goroutine of the workload.
+func (p WorkloadParams) More(i int) bool {
+	if p.Deadline.IsZero() {
+		return i < p.Ops
+	}
+	return time.Now().Before(p.Deadline)
+}
+
+// StartOp returns the start time of the operation with the given index if
+// its latency is sampled, otherwise it returns the zero time. Reading the clock
+// costs about as much as an uncontended operation, so sampling reduces how
+// much the measurement itself dilutes the profiler overhead.
+func (p WorkloadParams) StartOp(i int) time.Time {
+	if p.LatencySample <= 0 || i%p.LatencySample != 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// WorkloadResult holds the measurements taken by a workload during Run.
+type WorkloadResult struct {
+	// Ops is the number of operations completed by the workload. Operations
+	// involving several goroutines, e.g. a channel send and the matching
+	// receive, are counted once.
+	Ops int64
+	// Latencies contains the duration of the individual blocking operations
+	// performed by the workload, sampled according to
+	// WorkloadParams.LatencySample.
+	Latencies *Histogram
+	// AllocBytes is the number of bytes allocated by the operations of
+	// allocation workloads, or 0.
+	AllocBytes int64
+	// Collections contains the duration of every profile collected by the
+	// workload, or nil if it didn't collect any profiles.
+	Collections *Histogram
+}
+
+// Names of optional workload parameters.
+const (
+	ParamBufsize         = "bufsize"
+	ParamLockGoroutines  = "lockgoroutines"
+	ParamCriticalSection = "criticalsection"
+	ParamGoroutineDebug  = "goroutinedebug"
+	ParamCollectInterval = "collectinterval"
+	ParamIdleGoroutines  = "idlegoroutines"
+	ParamLabels          = "labels"
+)
+
+var registry = map[string]Workload{}
+
+// RegisterWorkload makes w available under the given name. It panics if the
+// name is already taken. Programs embedding the harness register their own
+// workloads before calling Main.
+func RegisterWorkload(name string, w Workload) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("workload registered twice: %q", name))
+	}
+	registry[name] = w
+}
+
+// LookupWorkload returns the workload registered under name.
+func LookupWorkload(name string) (Workload, error) {
+	w, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown workload: %q: available workloads: %s", name, strings.Join(WorkloadNames(), ", "))
+	}
+	return w, nil
+}
+
+// WorkloadNames returns the names of all registered workloads in sorted
+// order.
+func WorkloadNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasParam(w Workload, param string) bool {
+	for _, p := range w.Params() {
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+func listWorkloads(w io.Writer) error {
+	for _, name := range WorkloadNames() {
+		workload := registry[name]
+		params := "-"
+		if len(workload.Params()) > 0 {
+			params = strings.Join(workload.Params(), ",")
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s (params: %s)\n", name, workload.Description(), params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("allocsmall", allocWorkload{size: 32})
+	RegisterWorkload("alloclarge", allocWorkload{size: 64 * 1024})
+}
+
+// allocStacks is the number of distinct stacks the alloc workloads allocate
+// from, so that the heap profile has more than one bucket per goroutine.
+const allocStacks = 16
+
+// allocWorkload allocates objects of a fixed size, which are handled by
+// different code paths in the allocator depending on the size, e.g. objects
+// larger than 32 KiB bypass the per-P caches.
+type allocWorkload struct {
+	size int
+}
+
+func (w allocWorkload) Description() string {
+	return fmt.Sprintf("goroutines allocating %d byte objects from %d different stacks", w.size, allocStacks)
+}
+
+func (allocWorkload) Params() []string {
+	return nil
+}
+
+func (w allocWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	hists := make([]*Histogram, p.Goroutines)
+	sinks := make([][]byte, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for g := 0; g < p.Goroutines; g++ {
+		g := g
+		h := NewHistogram()
+		hists[g] = h
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			var sink []byte
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				sink = allocAt(i%allocStacks, w.size)
+				h.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			sinks[g] = sink
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{
+		Ops:        ops,
+		Latencies:  MergeHistograms(hists),
+		AllocBytes: ops * int64(w.size),
+	}, nil
+}
+
+// allocAt allocates a slice of the given size after recursing n times. It
+// must not be inlined, as the allocations could otherwise end up on the stack.
+//
+//go:noinline
+func allocAt(n, size int) []byte {
+	if n > 0 {
+		return allocAt(n-1, size)
+	}
+	return make([]byte, size)
+}
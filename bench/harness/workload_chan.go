@@ -0,0 +1,61 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("chan", chanWorkload{})
+}
+
+type chanWorkload struct{}
+
+func (chanWorkload) Description() string {
+	return "pairs of goroutines sending and receiving on a channel"
+}
+
+func (chanWorkload) Params() []string {
+	return []string{ParamBufsize}
+}
+
+func (chanWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines%2 != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of 2", p.Goroutines)
+	}
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/2; j++ {
+		ch := make(chan struct{}, p.Bufsize)
+		sendHist, recvHist := NewHistogram(), NewHistogram()
+		hists[j*2], hists[j*2+1] = sendHist, recvHist
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				ch <- struct{}{}
+				sendHist.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			close(ch)
+		})
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				start := p.StartOp(i)
+				if _, ok := <-ch; !ok {
+					return
+				}
+				recvHist.RecordSince(start)
+			}
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
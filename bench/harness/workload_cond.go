@@ -0,0 +1,110 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("cond", condWorkload{})
+}
+
+type condWorkload struct{}
+
+func (condWorkload) Description() string {
+	return "pairs of goroutines meeting at a barrier implemented via sync.Cond broadcast"
+}
+
+func (condWorkload) Params() []string {
+	return nil
+}
+
+func (condWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines%2 != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of 2", p.Goroutines)
+	}
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/2; j++ {
+		b := newCondBarrier(2)
+		for k := 0; k < 2; k++ {
+			k := k
+			h := NewHistogram()
+			hists[j*2+k] = h
+			wg.Add(1)
+			go AtStackDepth(p.Depth, func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					// The first goroutine of the pair decides when to stop,
+					// so both perform the same number of Wait calls.
+					if k == 0 && !p.More(i) {
+						b.Stop()
+					}
+					start := p.StartOp(i)
+					if b.Wait() {
+						// Every completed Wait of the pair counts as a
+						// single operation.
+						if k == 0 {
+							atomic.AddInt64(&ops, int64(i))
+						}
+						return
+					}
+					h.RecordSince(start)
+				}
+			})
+		}
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
+
+// condBarrier is a reusable barrier for n goroutines. The last goroutine to
+// arrive wakes up the others using sync.Cond.Broadcast.
+type condBarrier struct {
+	n          int
+	cond       *sync.Cond
+	arrived    int
+	generation int
+	// stopping is set by Stop, and copied to stopped when the current
+	// generation completes. This ensures that all goroutines of a generation
+	// see the same value, even if Stop is called before all of them woke up.
+	stopping bool
+	stopped  bool
+}
+
+func newCondBarrier(n int) *condBarrier {
+	return &condBarrier{n: n, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+// Wait blocks until all n goroutines have called Wait. It returns true if
+// Stop was called before the last goroutine arrived.
+func (b *condBarrier) Wait() bool {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	b.arrived++
+	if b.arrived == b.n {
+		b.arrived = 0
+		b.generation++
+		b.stopped = b.stopping
+		b.cond.Broadcast()
+		return b.stopped
+	}
+
+	generation := b.generation
+	for generation == b.generation {
+		b.cond.Wait()
+	}
+	return b.stopped
+}
+
+// Stop causes the Wait calls of the current and all future generations to
+// return true.
+func (b *condBarrier) Stop() {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+	b.stopping = true
+}
@@ -0,0 +1,63 @@
+package harness
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("cpu", cpuWorkload{})
+}
+
+// cpuOpIterations is the number of hash iterations performed by a single
+// operation of the cpu workload, which takes roughly 10µs on modern hardware.
+const cpuOpIterations = 10000
+
+type cpuWorkload struct{}
+
+func (cpuWorkload) Description() string {
+	return "goroutines performing cpu-bound hashing without blocking, e.g. for measuring the cpu profiler"
+}
+
+func (cpuWorkload) Params() []string {
+	return nil
+}
+
+func (cpuWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	hists := make([]*Histogram, p.Goroutines)
+	sums := make([]uint64, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for g := 0; g < p.Goroutines; g++ {
+		g := g
+		h := NewHistogram()
+		hists[g] = h
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			x := uint64(g + 1)
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				x = cpuHash(x, cpuOpIterations)
+				h.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			// Keep the result alive so the hashing can't be optimized away.
+			sums[g] = x
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
+
+// cpuHash applies n rounds of xorshift64* to x.
+func cpuHash(x uint64, n int) uint64 {
+	for i := 0; i < n; i++ {
+		x ^= x >> 12
+		x ^= x << 25
+		x ^= x >> 27
+		x *= 2685821657736338717
+	}
+	return x
+}
@@ -0,0 +1,123 @@
+package harness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	RegisterWorkload("goroutineprofile", goroutineProfileWorkload{})
+}
+
+// goroutineOpIterations is the number of hash iterations performed by a
+// single operation of the goroutineprofile workload, which takes roughly 1µs.
+const goroutineOpIterations = 1000
+
+type goroutineProfileWorkload struct{}
+
+func (goroutineProfileWorkload) Description() string {
+	return "goroutines performing short cpu-bound operations while the goroutine profile is collected every collectinterval"
+}
+
+func (goroutineProfileWorkload) Params() []string {
+	return []string{ParamGoroutineDebug, ParamCollectInterval, ParamIdleGoroutines}
+}
+
+func (goroutineProfileWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.GoroutineDebug < 0 || p.GoroutineDebug > 2 {
+		return nil, fmt.Errorf("bad goroutinedebug: %d: must be 0, 1 or 2", p.GoroutineDebug)
+	}
+
+	// The idle goroutines don't do anything, but make the goroutine profile
+	// more expensive to collect, like in a real service.
+	idleDone := make(chan struct{})
+	idleWg := &sync.WaitGroup{}
+	for g := 0; g < p.IdleGoroutines; g++ {
+		idleWg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer idleWg.Done()
+			<-idleDone
+		})
+	}
+	defer idleWg.Wait()
+	defer close(idleDone)
+
+	collector := startGoroutineCollector(p.GoroutineDebug, p.CollectInterval)
+
+	hists := make([]*Histogram, p.Goroutines)
+	sums := make([]uint64, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for g := 0; g < p.Goroutines; g++ {
+		g := g
+		h := NewHistogram()
+		hists[g] = h
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			x := uint64(g + 1)
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				x = cpuHash(x, goroutineOpIterations)
+				h.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			sums[g] = x
+		})
+	}
+	wg.Wait()
+
+	return &WorkloadResult{
+		Ops:         ops,
+		Latencies:   MergeHistograms(hists),
+		Collections: collector.Stop(),
+	}, nil
+}
+
+// goroutineCollector collects goroutine profiles in the background and
+// records how long every collection took.
+type goroutineCollector struct {
+	collections *Histogram
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// startGoroutineCollector starts collecting goroutine profiles with the given
+// debug value every interval. No profiles are collected if interval is 0.
+func startGoroutineCollector(debug int, interval time.Duration) *goroutineCollector {
+	c := &goroutineCollector{done: make(chan struct{})}
+	if interval <= 0 {
+		return c
+	}
+	c.collections = NewHistogram()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				start := time.Now()
+				pprof.Lookup("goroutine").WriteTo(ioutil.Discard, debug)
+				c.collections.Record(time.Since(start))
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// Stop stops the collector and returns the durations of all collections, or
+// nil if the collector was started without an interval.
+func (c *goroutineCollector) Stop() *Histogram {
+	close(c.done)
+	c.wg.Wait()
+	return c.collections
+}
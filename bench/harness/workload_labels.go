@@ -0,0 +1,181 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("labels", labelsWorkload{})
+}
+
+// labelsOpIterations is the number of hash iterations performed by a single
+// operation of the labels workload, which takes roughly 1µs.
+const labelsOpIterations = 1000
+
+// labelsOpSets is the number of different label sets used by the operations
+// of a goroutine when labels are set per operation, e.g. one per endpoint of
+// a service.
+const labelsOpSets = 16
+
+type labelsWorkload struct{}
+
+func (labelsWorkload) Description() string {
+	return "pairs of goroutines hashing and passing the results over a channel with pprof labels set per goroutine or per op, while goroutine profiles are collected every collectinterval"
+}
+
+func (labelsWorkload) Params() []string {
+	return []string{ParamLabels, ParamBufsize, ParamIdleGoroutines, ParamGoroutineDebug, ParamCollectInterval}
+}
+
+func (labelsWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines%2 != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of 2", p.Goroutines)
+	} else if p.GoroutineDebug < 0 || p.GoroutineDebug > 2 {
+		return nil, fmt.Errorf("bad goroutinedebug: %d: must be 0, 1 or 2", p.GoroutineDebug)
+	}
+	labels, err := parseLabels(p.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like in a real service, the idle goroutines carry labels as well, which
+	// are included in every goroutine profile.
+	idleDone := make(chan struct{})
+	idleWg := &sync.WaitGroup{}
+	for g := 0; g < p.IdleGoroutines; g++ {
+		g := g
+		idleWg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer idleWg.Done()
+			labels.SetGoroutineLabels("idle", g)
+			<-idleDone
+		})
+	}
+	defer idleWg.Wait()
+	defer close(idleDone)
+
+	collector := startGoroutineCollector(p.GoroutineDebug, p.CollectInterval)
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/2; j++ {
+		j := j
+		ch := make(chan uint64, p.Bufsize)
+		sendHist, recvHist := NewHistogram(), NewHistogram()
+		hists[j*2], hists[j*2+1] = sendHist, recvHist
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			labels.SetGoroutineLabels("send", j)
+			x := uint64(j + 1)
+			send := func() {
+				x = cpuHash(x, labelsOpIterations)
+				ch <- x
+			}
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				labels.Do(i, send)
+				sendHist.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			close(ch)
+		})
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			labels.SetGoroutineLabels("recv", j)
+			var ok bool
+			recv := func() { _, ok = <-ch }
+			for i := 0; ; i++ {
+				start := p.StartOp(i)
+				if labels.Do(i, recv); !ok {
+					return
+				}
+				recvHist.RecordSince(start)
+			}
+		})
+	}
+	wg.Wait()
+
+	return &WorkloadResult{
+		Ops:         ops,
+		Latencies:   MergeHistograms(hists),
+		Collections: collector.Stop(),
+	}, nil
+}
+
+// labelConfig describes the pprof labels used by a workload. It's parsed
+// from the labels param, which is one of:
+//
+//	none    no labels
+//	<n>     n labels set once by every goroutine
+//	<n>/op  n labels set for every operation using pprof.Do
+type labelConfig struct {
+	// N is the number of labels, or 0 for none.
+	N int
+	// PerOp is true if the labels are set for every operation instead of
+	// once per goroutine.
+	PerOp bool
+
+	opSets []pprof.LabelSet
+}
+
+func parseLabels(s string) (*labelConfig, error) {
+	if s == "" || s == "none" {
+		return &labelConfig{}, nil
+	}
+	c := &labelConfig{}
+	n := s
+	if strings.HasSuffix(s, "/op") {
+		c.PerOp = true
+		n = strings.TrimSuffix(s, "/op")
+	}
+	var err error
+	if c.N, err = strconv.Atoi(n); err != nil || c.N < 1 {
+		return nil, fmt.Errorf("bad labels: %q: must be none, <n> or <n>/op with n >= 1", s)
+	}
+	if c.PerOp {
+		for i := 0; i < labelsOpSets; i++ {
+			c.opSets = append(c.opSets, labelSet(c.N, fmt.Sprintf("op%d", i)))
+		}
+	}
+	return c, nil
+}
+
+// SetGoroutineLabels sets the labels of the calling goroutine unless they are
+// set per operation. The labels are unique for every goroutine, like request
+// ids in a real service.
+func (c *labelConfig) SetGoroutineLabels(role string, i int) {
+	if c.N == 0 || c.PerOp {
+		return
+	}
+	ctx := pprof.WithLabels(context.Background(), labelSet(c.N, fmt.Sprintf("%s%d", role, i)))
+	pprof.SetGoroutineLabels(ctx)
+}
+
+// Do calls fn, using pprof.Do with one of the label sets if the labels are
+// set for every operation. i is the index of the operation.
+func (c *labelConfig) Do(i int, fn func()) {
+	if !c.PerOp {
+		fn()
+		return
+	}
+	pprof.Do(context.Background(), c.opSets[i%len(c.opSets)], func(context.Context) { fn() })
+}
+
+// labelSet returns n labels whose values start with the given prefix.
+func labelSet(n int, prefix string) pprof.LabelSet {
+	args := make([]string, 0, n*2)
+	for k := 0; k < n; k++ {
+		args = append(args, fmt.Sprintf("key%d", k), fmt.Sprintf("%s-%d", prefix, k))
+	}
+	return pprof.Labels(args...)
+}
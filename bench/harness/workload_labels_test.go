@@ -0,0 +1,30 @@
+package harness
+
+import "testing"
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		in    string
+		n     int
+		perOp bool
+	}{
+		{"none", 0, false},
+		{"", 0, false},
+		{"8", 8, false},
+		{"4/op", 4, true},
+	}
+	for _, test := range tests {
+		c, err := parseLabels(test.in)
+		if err != nil {
+			t.Fatal(err)
+		} else if c.N != test.n || c.PerOp != test.perOp {
+			t.Errorf("%q: got n=%d perOp=%v, want n=%d perOp=%v", test.in, c.N, c.PerOp, test.n, test.perOp)
+		}
+	}
+
+	for _, in := range []string{"0", "-1", "op", "/op", "4/goroutine"} {
+		if _, err := parseLabels(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("mutex", mutexWorkload{})
+}
+
+type mutexWorkload struct{}
+
+func (mutexWorkload) Description() string {
+	return "groups of lockgoroutines goroutines contending on a sync.Mutex, holding it for criticalsection"
+}
+
+func (mutexWorkload) Params() []string {
+	return []string{ParamLockGoroutines, ParamCriticalSection}
+}
+
+func (mutexWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.LockGoroutines < 1 {
+		return nil, fmt.Errorf("bad lockgoroutines: %d: must be >= 1", p.LockGoroutines)
+	} else if p.Goroutines%p.LockGoroutines != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of lockgoroutines %d", p.Goroutines, p.LockGoroutines)
+	}
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/p.LockGoroutines; j++ {
+		m := &sync.Mutex{}
+		for k := 0; k < p.LockGoroutines; k++ {
+			h := NewHistogram()
+			hists[j*p.LockGoroutines+k] = h
+			wg.Add(1)
+			go AtStackDepth(p.Depth, func() {
+				defer wg.Done()
+				i := 0
+				for ; p.More(i); i++ {
+					start := p.StartOp(i)
+					m.Lock()
+					h.RecordSince(start)
+					if p.CriticalSection > 0 {
+						SpinSleep(p.CriticalSection)
+					}
+					m.Unlock()
+				}
+				atomic.AddInt64(&ops, int64(i))
+			})
+		}
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
@@ -0,0 +1,62 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("rwmutex", rwmutexWorkload{})
+}
+
+type rwmutexWorkload struct{}
+
+func (rwmutexWorkload) Description() string {
+	return "pairs of a reader and a writer goroutine contending on a sync.RWMutex"
+}
+
+func (rwmutexWorkload) Params() []string {
+	return nil
+}
+
+func (rwmutexWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines%2 != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of 2", p.Goroutines)
+	}
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/2; j++ {
+		m := &sync.RWMutex{}
+		writeHist, readHist := NewHistogram(), NewHistogram()
+		hists[j*2], hists[j*2+1] = writeHist, readHist
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				m.Lock()
+				m.Unlock()
+				writeHist.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+		})
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				m.RLock()
+				m.RUnlock()
+				readHist.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
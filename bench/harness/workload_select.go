@@ -0,0 +1,78 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+func init() {
+	RegisterWorkload("select", selectWorkload{})
+}
+
+// selectCases is the number of channels each receiver selects on.
+const selectCases = 4
+
+type selectWorkload struct{}
+
+func (selectWorkload) Description() string {
+	return "pairs of goroutines sending round-robin on channels and receiving via a multi-case select"
+}
+
+func (selectWorkload) Params() []string {
+	return []string{ParamBufsize}
+}
+
+func (selectWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines%2 != 0 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be a multiple of 2", p.Goroutines)
+	}
+
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines/2; j++ {
+		var chs [selectCases]chan struct{}
+		for i := range chs {
+			chs[i] = make(chan struct{}, p.Bufsize)
+		}
+		sendHist, recvHist := NewHistogram(), NewHistogram()
+		hists[j*2], hists[j*2+1] = sendHist, recvHist
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				chs[i%selectCases] <- struct{}{}
+				sendHist.RecordSince(start)
+			}
+			atomic.AddInt64(&ops, int64(i))
+			for _, ch := range chs {
+				close(ch)
+			}
+		})
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				start := p.StartOp(i)
+				// All channels are closed at the same time, after all values
+				// have been sent.
+				var ok bool
+				select {
+				case _, ok = <-chs[0]:
+				case _, ok = <-chs[1]:
+				case _, ok = <-chs[2]:
+				case _, ok = <-chs[3]:
+				}
+				if !ok {
+					return
+				}
+				recvHist.RecordSince(start)
+			}
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
@@ -0,0 +1,49 @@
+package harness
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkloads runs every registered workload with a small number of ops to
+// catch workloads that fail or never finish.
+func TestWorkloads(t *testing.T) {
+	p := WorkloadParams{
+		Goroutines:      4,
+		Ops:             100,
+		Depth:           4,
+		Bufsize:         1,
+		LockGoroutines:  2,
+		GoroutineDebug:  1,
+		CollectInterval: time.Millisecond,
+		IdleGoroutines:  2,
+		Labels:          "2/op",
+		LatencySample:   1,
+	}
+	for _, name := range WorkloadNames() {
+		w, err := LookupWorkload(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error, 1)
+		var result *WorkloadResult
+		go func() {
+			var err error
+			result, err = w.Run(p)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if result == nil {
+				t.Errorf("%s: nil result", name)
+			} else if result.Ops == 0 {
+				t.Errorf("%s: no ops completed", name)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: did not finish", name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package harness
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	RegisterWorkload("timer", timerWorkload{})
+}
+
+// timerDuration is the duration of every timer used by the timer workload.
+const timerDuration = time.Microsecond
+
+type timerWorkload struct{}
+
+func (timerWorkload) Description() string {
+	return "goroutines waiting for a time.Timer channel to fire"
+}
+
+func (timerWorkload) Params() []string {
+	return nil
+}
+
+func (timerWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	hists := make([]*Histogram, p.Goroutines)
+	var ops int64
+	wg := &sync.WaitGroup{}
+	for j := 0; j < p.Goroutines; j++ {
+		h := NewHistogram()
+		hists[j] = h
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			t := time.NewTimer(timerDuration)
+			defer t.Stop()
+			i := 0
+			for ; p.More(i); i++ {
+				start := p.StartOp(i)
+				<-t.C
+				h.RecordSince(start)
+				t.Reset(timerDuration)
+			}
+			atomic.AddInt64(&ops, int64(i))
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: MergeHistograms(hists)}, nil
+}
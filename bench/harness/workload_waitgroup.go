@@ -0,0 +1,72 @@
+package harness
+
+import (
+	"fmt"
+	"sync"
+)
+
+func init() {
+	RegisterWorkload("waitgroup", waitgroupWorkload{})
+}
+
+type waitgroupWorkload struct{}
+
+func (waitgroupWorkload) Description() string {
+	return "one goroutine fanning in the results of all others via sync.WaitGroup.Wait"
+}
+
+func (waitgroupWorkload) Params() []string {
+	return nil
+}
+
+// Run starts one waiter and goroutines-1 producers. For every op, the waiter
+// starts a new round by sending a fresh WaitGroup on the channel of every
+// producer and waits for all producers to call Done on it. Only the latency of
+// the Wait calls is recorded, but the block profile will also include the
+// producers waiting to receive the next round.
+func (waitgroupWorkload) Run(p WorkloadParams) (*WorkloadResult, error) {
+	if p.Goroutines < 2 {
+		return nil, fmt.Errorf("bad goroutines: %d: must be >= 2", p.Goroutines)
+	}
+
+	producers := p.Goroutines - 1
+	rounds := make([]chan *sync.WaitGroup, producers)
+	for i := range rounds {
+		rounds[i] = make(chan *sync.WaitGroup)
+	}
+
+	h := NewHistogram()
+	var ops int64
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go AtStackDepth(p.Depth, func() {
+		defer wg.Done()
+		i := 0
+		for ; p.More(i); i++ {
+			round := &sync.WaitGroup{}
+			round.Add(producers)
+			for _, ch := range rounds {
+				ch <- round
+			}
+			start := p.StartOp(i)
+			round.Wait()
+			h.RecordSince(start)
+		}
+		ops = int64(i)
+		for _, ch := range rounds {
+			close(ch)
+		}
+	})
+	for _, ch := range rounds {
+		ch := ch
+		wg.Add(1)
+		go AtStackDepth(p.Depth, func() {
+			defer wg.Done()
+			for round := range ch {
+				round.Done()
+			}
+		})
+	}
+	wg.Wait()
+	return &WorkloadResult{Ops: ops, Latencies: h}, nil
+}
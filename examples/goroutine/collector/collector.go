@@ -0,0 +1,267 @@
+// Package collector takes goroutine snapshots in the background and keeps the
+// most recent ones in memory, so that they can be written to disk with some
+// context before and after something interesting happened.
+package collector
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
+)
+
+// DefaultProfiles are the profiles taken if the Collector has no Snapshotter.
+// The debug=2 format includes the wait times and creators of the goroutines,
+// which is what the diff command needs, but it stops the world for as long as
+// it takes to write the stacks of all goroutines.
+var DefaultProfiles = []snapshot.Profile{
+	{
+		Name: "pprof.lookup.goroutine.debug2.txt",
+		WriteTo: func(w io.Writer) error {
+			return pprof.Lookup("goroutine").WriteTo(w, 2)
+		},
+	},
+}
+
+// Collector takes a snapshot every Interval and keeps the last ones in a
+// ring. When one of the Triggers fires or one of the Signals is received, the
+// ring is written into a tar archive in Dir, and the next After snapshots are
+// added to the same archive.
+type Collector struct {
+	// Snapshotter takes the snapshots. A Snapshotter with DefaultProfiles is
+	// used if it's nil.
+	Snapshotter *snapshot.Snapshotter
+	// Interval is the time between two snapshots, 10s if it's zero.
+	Interval time.Duration
+	// MaxSnapshots and MaxBytes limit the number and total size of the
+	// snapshots kept in the ring, the oldest snapshots are dropped first. The
+	// newest snapshot is always kept. They default to 60 snapshots and 64 MiB.
+	MaxSnapshots int
+	MaxBytes     int
+	// After is the number of snapshots added to an archive after it was
+	// written because of a trigger.
+	After int
+	// Triggers are checked after every snapshot.
+	Triggers []Trigger
+	// Signals write the ring after taking a snapshot when they're received,
+	// e.g. syscall.SIGQUIT. Note that the runtime no longer dumps all
+	// goroutines and exits on signals that are handled by the collector.
+	Signals []os.Signal
+	// Dir is the directory the archives are written to, which is created if
+	// needed.
+	Dir string
+	// OnWrite is called after an archive was written, if it's not nil.
+	OnWrite func(path string, reasons []string)
+	// OnError is called when a trigger fails to check a snapshot. The
+	// trigger is skipped for this snapshot and the collector keeps running.
+	// The errors are logged if it's nil.
+	OnError func(err error)
+
+	ring     ring
+	active   []bool
+	incident *incident
+}
+
+// incident is an archive that is still waiting for more snapshots.
+type incident struct {
+	Path      string               `json:"-"`
+	Time      time.Time            `json:"time"`
+	Reasons   []string             `json:"reasons"`
+	Snapshots []*snapshot.Snapshot `json:"-"`
+	remaining int
+}
+
+// incidentName is the name of the file describing the incident in an archive.
+const incidentName = "incident.json"
+
+// Run takes snapshots until ctx is done, which makes it return nil. It
+// returns the first error encountered while taking a snapshot or writing an
+// archive. Errors of triggers are passed to OnError instead.
+func (c *Collector) Run(ctx context.Context) error {
+	sigCh := make(chan os.Signal, 1)
+	if len(c.Signals) > 0 {
+		signal.Notify(sigCh, c.Signals...)
+		defer signal.Stop(sigCh)
+	}
+	interval := c.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reason string
+	for {
+		if err := c.collect(reason); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reason = ""
+		case sig := <-sigCh:
+			reason = "received " + sig.String()
+		}
+	}
+}
+
+// collect takes a snapshot, checks the triggers and writes the archive if
+// needed. A non-empty reason writes the archive regardless of the triggers.
+func (c *Collector) collect(reason string) error {
+	snapshotter := c.Snapshotter
+	if snapshotter == nil {
+		snapshotter = &snapshot.Snapshotter{Profiles: DefaultProfiles}
+		c.Snapshotter = snapshotter
+	}
+	snap, err := snapshotter.Take()
+	if err != nil {
+		return err
+	}
+	c.ring.push(snap, c.MaxSnapshots, c.MaxBytes)
+
+	var reasons []string
+	if reason != "" {
+		reasons = append(reasons, reason)
+	}
+	// Triggers might be added or removed between two snapshots.
+	if len(c.active) != len(c.Triggers) {
+		active := make([]bool, len(c.Triggers))
+		copy(active, c.active)
+		c.active = active
+	}
+	for i, t := range c.Triggers {
+		reason, err := t.Check(c.ring.snapshots)
+		if err != nil {
+			c.onError(fmt.Errorf("trigger %d: %w", i, err))
+			continue
+		}
+		// Triggers only fire when their condition starts to hold, otherwise
+		// a high goroutine count would write an archive for every snapshot.
+		if reason != "" && !c.active[i] {
+			reasons = append(reasons, reason)
+		}
+		c.active[i] = reason != ""
+	}
+
+	switch {
+	case len(reasons) > 0 && c.incident != nil:
+		c.incident.Reasons = append(c.incident.Reasons, reasons...)
+		c.incident.Snapshots = append(c.incident.Snapshots, snap)
+		c.incident.remaining--
+	case len(reasons) > 0:
+		c.incident = &incident{
+			Path:      filepath.Join(c.Dir, fmt.Sprintf("goroutines.%s.%d.tar", snap.Time.Format("20060102T150405"), snap.Seq)),
+			Time:      snap.Time,
+			Reasons:   reasons,
+			Snapshots: append([]*snapshot.Snapshot{}, c.ring.snapshots...),
+			remaining: c.After,
+		}
+	case c.incident != nil:
+		c.incident.Snapshots = append(c.incident.Snapshots, snap)
+		c.incident.remaining--
+	default:
+		return nil
+	}
+
+	inc := c.incident
+	if inc.remaining <= 0 {
+		c.incident = nil
+	}
+	if err := inc.write(); err != nil {
+		return err
+	} else if c.OnWrite != nil {
+		c.OnWrite(inc.Path, inc.Reasons)
+	}
+	return nil
+}
+
+func (c *Collector) onError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	} else {
+		log.Printf("collector: %s", err)
+	}
+}
+
+// write writes the archive of the incident, replacing the previous version
+// only once the new one is complete, so that an incident that crashes the
+// program doesn't destroy the archive.
+func (inc *incident) write() error {
+	if err := os.MkdirAll(filepath.Dir(inc.Path), 0777); err != nil {
+		return err
+	}
+	tmp := inc.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	data, err := json.MarshalIndent(inc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	tw := tar.NewWriter(f)
+	hdr := &tar.Header{Name: incidentName, Mode: 0666, Size: int64(len(data)), ModTime: inc.Time}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	} else if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, snap := range inc.Snapshots {
+		if err := snap.WriteTar(tw); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, inc.Path)
+}
+
+// ring holds the most recent snapshots, starting with the oldest.
+type ring struct {
+	snapshots []*snapshot.Snapshot
+	bytes     int
+}
+
+// push adds snap to the ring and drops the oldest snapshots until at most
+// maxSnapshots with at most maxBytes are left, or only snap.
+func (r *ring) push(snap *snapshot.Snapshot, maxSnapshots, maxBytes int) {
+	if maxSnapshots <= 0 {
+		maxSnapshots = 60
+	}
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	r.snapshots = append(r.snapshots, snap)
+	r.bytes += size(snap)
+	for len(r.snapshots) > 1 && (len(r.snapshots) > maxSnapshots || r.bytes > maxBytes) {
+		r.bytes -= size(r.snapshots[0])
+		r.snapshots[0] = nil
+		r.snapshots = r.snapshots[1:]
+	}
+}
+
+// size returns the number of bytes of the profiles of snap.
+func size(snap *snapshot.Snapshot) int {
+	var n int
+	for _, f := range snap.Files {
+		n += len(f.Data)
+	}
+	return n
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
+)
+
+func TestCollector(t *testing.T) {
+	var written []string
+	c := &Collector{
+		Interval: time.Millisecond,
+		After:    2,
+		Triggers: []Trigger{CountAbove(0)},
+		Dir:      t.TempDir(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.OnWrite = func(path string, reasons []string) {
+		written = append(written, path)
+		if len(written) == c.After+1 {
+			cancel()
+		}
+	}
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive is rewritten for every snapshot after the trigger fired.
+	for _, path := range written[1:] {
+		if path != written[0] {
+			t.Fatalf("got archives %v, want one", written)
+		}
+	}
+	f, err := os.Open(written[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name != incidentName {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var inc incident
+		if err := json.Unmarshal(data, &inc); err != nil {
+			t.Fatal(err)
+		} else if len(inc.Reasons) != 1 || !strings.Contains(inc.Reasons[0], "more than 0") {
+			t.Errorf("got reasons %q", inc.Reasons)
+		}
+	}
+	want := []string{
+		incidentName,
+		"1.snapshot.json", "1.pprof.lookup.goroutine.debug2.txt",
+		"2.snapshot.json", "2.pprof.lookup.goroutine.debug2.txt",
+		"3.snapshot.json", "3.pprof.lookup.goroutine.debug2.txt",
+	}
+	if got := strings.Join(names, " "); got != strings.Join(want, " ") {
+		t.Errorf("got entries %s, want %s", got, strings.Join(want, " "))
+	}
+}
+
+func TestCollectorTriggerError(t *testing.T) {
+	var errs []error
+	fail := TriggerFunc(func([]*snapshot.Snapshot) (string, error) {
+		return "", errors.New("boom")
+	})
+	c := &Collector{
+		Triggers: []Trigger{fail},
+		Dir:      t.TempDir(),
+		OnError:  func(err error) { errs = append(errs, err) },
+	}
+	if err := c.collect(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A trigger added later must be checked as well, and fire even though
+	// the first one keeps failing.
+	var written []string
+	c.OnWrite = func(path string, reasons []string) { written = append(written, path) }
+	c.Triggers = append(c.Triggers, CountAbove(0))
+	if err := c.collect(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "boom") {
+		t.Errorf("got errors %v, want 2 boom errors", errs)
+	} else if len(written) != 1 {
+		t.Errorf("got archives %v, want one", written)
+	}
+}
+
+func TestRing(t *testing.T) {
+	var r ring
+	for i := 1; i <= 5; i++ {
+		r.push(&snapshot.Snapshot{Seq: i, Files: []snapshot.File{{Data: make([]byte, 10*i)}}}, 3, 150)
+	}
+	if got, want := seqs(r.snapshots), "3 4 5"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	r.push(&snapshot.Snapshot{Seq: 6, Files: []snapshot.File{{Data: make([]byte, 100)}}}, 3, 150)
+	if got, want := seqs(r.snapshots), "5 6"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	} else if r.bytes != 150 {
+		t.Errorf("got %d bytes, want 150", r.bytes)
+	}
+	// The newest snapshot is kept even if it's too big.
+	r.push(&snapshot.Snapshot{Seq: 7, Files: []snapshot.File{{Data: make([]byte, 200)}}}, 3, 150)
+	if got, want := seqs(r.snapshots), "7"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func seqs(snaps []*snapshot.Snapshot) string {
+	var s []string
+	for _, snap := range snaps {
+		s = append(s, strconv.Itoa(snap.Seq))
+	}
+	return strings.Join(s, " ")
+}
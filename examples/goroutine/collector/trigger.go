@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/dump"
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
+)
+
+// Trigger decides whether the ring should be written after a snapshot was
+// taken.
+type Trigger interface {
+	// Check returns why the ring should be written, or "" if it shouldn't.
+	// The ring holds the snapshots starting with the oldest, so the last one
+	// is the snapshot that was just taken.
+	Check(ring []*snapshot.Snapshot) (string, error)
+}
+
+// TriggerFunc adapts a function to the Trigger interface.
+type TriggerFunc func(ring []*snapshot.Snapshot) (string, error)
+
+// Check calls f(ring).
+func (f TriggerFunc) Check(ring []*snapshot.Snapshot) (string, error) {
+	return f(ring)
+}
+
+// CountAbove fires if there are more than n goroutines.
+func CountAbove(n int) Trigger {
+	return TriggerFunc(func(ring []*snapshot.Snapshot) (string, error) {
+		if count := ring[len(ring)-1].Goroutines; count > n {
+			return fmt.Sprintf("%d goroutines, more than %d", count, n), nil
+		}
+		return "", nil
+	})
+}
+
+// GrowthAbove fires if the number of goroutines grew by more than n within
+// d, compared to the oldest snapshot in the ring that is at most d old.
+func GrowthAbove(n int, d time.Duration) Trigger {
+	return TriggerFunc(func(ring []*snapshot.Snapshot) (string, error) {
+		newest := ring[len(ring)-1]
+		for _, snap := range ring {
+			if newest.Time.Sub(snap.Time) > d {
+				continue
+			}
+			if growth := newest.Goroutines - snap.Goroutines; growth > n {
+				return fmt.Sprintf("%d goroutines, %d more than %s ago", newest.Goroutines, growth, newest.Time.Sub(snap.Time).Round(time.Millisecond)), nil
+			}
+			break
+		}
+		return "", nil
+	})
+}
+
+// StackContains fires if a goroutine is calling the function fn, e.g.
+// "database/sql.(*DB).conn". The newest snapshot must include a goroutine
+// profile in the debug=0, debug=1 or debug=2 format.
+func StackContains(fn string) Trigger {
+	return TriggerFunc(func(ring []*snapshot.Snapshot) (string, error) {
+		p, err := parseSnapshot(ring[len(ring)-1])
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		for _, s := range p.Samples {
+			for _, f := range s.Frames() {
+				if f.Func == fn {
+					count += s.Count
+					break
+				}
+			}
+		}
+		if count > 0 {
+			return fmt.Sprintf("%d goroutines calling %s", count, fn), nil
+		}
+		return "", nil
+	})
+}
+
+// parseSnapshot parses the first profile of snap in a format supported by the
+// dump package.
+func parseSnapshot(snap *snapshot.Snapshot) (*dump.Profile, error) {
+	for _, f := range snap.Files {
+		if _, err := dump.DetectFormat(f.Data); err != nil {
+			continue
+		}
+		p, _, err := dump.Parse(f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", snap.FileName(f), err)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("snapshot %d: no goroutine profile", snap.Seq)
+}
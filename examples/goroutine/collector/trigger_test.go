@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
+)
+
+func TestGrowthAbove(t *testing.T) {
+	start := time.Now()
+	var ring []*snapshot.Snapshot
+	check := func(goroutines int, after time.Duration) string {
+		t.Helper()
+		ring = append(ring, &snapshot.Snapshot{Time: start.Add(after), Goroutines: goroutines})
+		reason, err := GrowthAbove(10, time.Minute).Check(ring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reason
+	}
+	if reason := check(10, 0); reason != "" {
+		t.Errorf("fired for the first snapshot: %s", reason)
+	}
+	if reason := check(20, 30*time.Second); reason != "" {
+		t.Errorf("fired for a growth of 10: %s", reason)
+	}
+	if got, want := check(21, 50*time.Second), "21 goroutines, 11 more than 50s ago"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if reason := check(35, 2*time.Minute); reason != "" {
+		t.Errorf("fired for a growth older than a minute: %s", reason)
+	}
+}
+
+func TestStackContains(t *testing.T) {
+	started, stop := make(chan struct{}), make(chan struct{})
+	defer close(stop)
+	go blockUntil(started, stop)
+	<-started
+
+	snap, err := (&snapshot.Snapshotter{Profiles: DefaultProfiles}).Take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := []*snapshot.Snapshot{snap}
+	fn := "github.com/felixge/go-profiler-notes/examples/goroutine/collector.blockUntil"
+	if reason, err := StackContains(fn).Check(ring); err != nil {
+		t.Fatal(err)
+	} else if want := "1 goroutines calling " + fn; reason != want {
+		t.Errorf("got %q, want %q", reason, want)
+	}
+	if reason, err := StackContains("main.missing").Check(ring); err != nil {
+		t.Fatal(err)
+	} else if reason != "" {
+		t.Errorf("fired for a missing function: %s", reason)
+	}
+}
+
+func blockUntil(started, stop chan struct{}) {
+	close(started)
+	<-stop
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/collector"
+	"github.com/felixge/go-profiler-notes/examples/goroutine/dump"
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
+)
+
+// commands are the subcommands of the program. Without a subcommand the
+// program runs the example and writes the snapshots.
+var commands = map[string]func(args []string) error{
+	"collect": collectCmd,
+	"convert": convertCmd,
+	"diff":    diffCmd,
+}
+
+// collectCmd starts the goroutines of the example and runs a collector until
+// it fails. With -leak, the example leaks a goroutine in regular intervals, so
+// that the triggers have something to find.
+func collectCmd(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	var (
+		c            = &collector.Collector{Signals: []os.Signal{syscall.SIGQUIT}}
+		countAbove   = fs.Int("count-above", 0, "Write the snapshots if there are more goroutines than this, 0 to disable.")
+		growthAbove  = fs.Int("growth-above", 0, "Write the snapshots if the number of goroutines grew by more than this within -growth-window, 0 to disable.")
+		growthWindow = fs.Duration("growth-window", time.Minute, "The window for -growth-above.")
+		stack        = fs.String("stack", "", "Write the snapshots if a goroutine is calling this function, e.g. main.shortSleepLoop.")
+		leak         = fs.Duration("leak", 0, "Leak a goroutine every time this duration passes, 0 to disable.")
+	)
+	fs.StringVar(&c.Dir, "dir", ".", "The directory to write the snapshots to.")
+	fs.DurationVar(&c.Interval, "interval", 10*time.Second, "The time between two snapshots.")
+	fs.IntVar(&c.MaxSnapshots, "max-snapshots", 60, "The number of snapshots to keep in memory.")
+	fs.IntVar(&c.MaxBytes, "max-bytes", 64<<20, "The total size of the snapshots to keep in memory.")
+	fs.IntVar(&c.After, "after", 6, "The number of snapshots to write after a trigger fired.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goroutine collect [flags]\n\nThe snapshots are also written on SIGQUIT (ctrl+\\).\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *countAbove > 0 {
+		c.Triggers = append(c.Triggers, collector.CountAbove(*countAbove))
+	}
+	if *growthAbove > 0 {
+		c.Triggers = append(c.Triggers, collector.GrowthAbove(*growthAbove, *growthWindow))
+	}
+	if *stack != "" {
+		c.Triggers = append(c.Triggers, collector.StackContains(*stack))
+	}
+	c.OnWrite = func(path string, reasons []string) {
+		fmt.Printf("Wrote %s: %s\n", path, strings.Join(reasons, ", "))
+	}
+
+	startGoroutines()
+	if *leak > 0 {
+		go func() {
+			for range time.Tick(*leak) {
+				indirectShortSleepLoop()
+			}
+		}()
+	}
+	fmt.Printf("Taking a snapshot every %s\n", c.Interval)
+	return c.Run(context.Background())
+}
+
+// convertCmd converts a profile or dump in any of the supported formats into
+// a profile.proto that can be loaded by `go tool pprof`.
+func convertCmd(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goroutine convert <input> <output.pb.gz>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	p, _, err := dump.ParseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// diffCmd reports the goroutines that appeared, disappeared or whose wait time
+// grew between two profiles or dumps in any of the supported formats. Instead
+// of single files, it also accepts the snapshots written by the example and
+// the collector.
+func diffCmd(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: goroutine diff <before> <after>\n       goroutine diff <snapshots>\n\n")
+		fmt.Fprintf(fs.Output(), "<before> and <after> are profiles or dumps, or directories or tar archives\n")
+		fmt.Fprintf(fs.Output(), "containing a single snapshot. Given a directory or tar archive with several\n")
+		fmt.Fprintf(fs.Output(), "snapshots, e.g. one written by the collector, the first and the last one are\n")
+		fmt.Fprintf(fs.Output(), "compared. The debug=2 profile of a snapshot is preferred, as it's the only\n")
+		fmt.Fprintf(fs.Output(), "format with individual goroutines. runtime.goroutineprofile.json files are\n")
+		fmt.Fprintf(fs.Output(), "not supported, as they only contain unsymbolized program counters.\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var before, after *dump.Profile
+	switch fs.NArg() {
+	case 1:
+		snaps, err := snapshot.Read(fs.Arg(0))
+		if err != nil {
+			return err
+		} else if len(snaps) < 2 {
+			return fmt.Errorf("%s: found %d snapshot, need at least 2", fs.Arg(0), len(snaps))
+		}
+		if before, err = snapshotProfile(snaps[0]); err != nil {
+			return err
+		}
+		if after, err = snapshotProfile(snaps[len(snaps)-1]); err != nil {
+			return err
+		}
+	case 2:
+		var err error
+		if before, err = diffInput(fs.Arg(0)); err != nil {
+			return err
+		}
+		if after, err = diffInput(fs.Arg(1)); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if before.Goroutines == nil || after.Goroutines == nil {
+		fmt.Printf("Comparing goroutine counts only, use the debug=2 format for both to compare individual goroutines.\n\n")
+	}
+	writeDiff(os.Stdout, dump.Diff(before, after))
+	return nil
+}
+
+// diffInput parses the profile or dump at path, or the single snapshot in the
+// directory or tar archive at path.
+func diffInput(path string) (*dump.Profile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() && !strings.HasSuffix(path, ".tar") {
+		p, _, err := dump.ParseFile(path)
+		return p, err
+	}
+
+	snaps, err := snapshot.Read(path)
+	if err != nil {
+		return nil, err
+	} else if len(snaps) != 1 {
+		return nil, fmt.Errorf("%s: found %d snapshots, pass it as the only argument to compare the first and the last one", path, len(snaps))
+	}
+	return snapshotProfile(snaps[0])
+}
+
+// snapshotProfile parses the most detailed profile of snap, preferring the
+// debug=2 format over debug=1 and debug=0.
+func snapshotProfile(snap *snapshot.Snapshot) (*dump.Profile, error) {
+	rank := map[dump.Format]int{dump.FormatDebug2: 3, dump.FormatDebug1: 2, dump.FormatDebug0: 1}
+	var best *snapshot.File
+	bestRank := 0
+	for i, f := range snap.Files {
+		format, err := dump.DetectFormat(f.Data)
+		if err == nil && rank[format] > bestRank {
+			best, bestRank = &snap.Files[i], rank[format]
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("snapshot %d: no goroutine profile", snap.Seq)
+	}
+	p, _, err := dump.Parse(best.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", snap.FileName(*best), err)
+	}
+	return p, nil
+}
+
+// writeDiff writes groups like this:
+//
+//	+1 goroutines (1 -> 2) created by main.main at /src/main.go:130
+//		time.Sleep /src/runtime/time.go:188
+//		main.shortSleepLoop /src/main.go:165
+//		appeared: 23 [sleep]
+//		wait grew: 4 [sleep, 0 -> 1 minutes]
+func writeDiff(w io.Writer, groups []*dump.DiffGroup) {
+	if len(groups) == 0 {
+		fmt.Fprintf(w, "No changes\n")
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%+d goroutines (%d -> %d)", g.Delta(), g.Before, g.After)
+		if g.CreatedBy != nil {
+			fmt.Fprintf(w, " created by %s at %s:%d", g.CreatedBy.Func, g.CreatedBy.File, g.CreatedBy.Line)
+		}
+		fmt.Fprintln(w)
+		for _, f := range g.Frames {
+			fmt.Fprintf(w, "\t%s %s:%d\n", f.Func, f.File, f.Line)
+		}
+		if len(g.Appeared) > 0 {
+			fmt.Fprintf(w, "\tappeared: %s\n", goroutineList(g.Appeared))
+		}
+		if len(g.Disappeared) > 0 {
+			fmt.Fprintf(w, "\tdisappeared: %s\n", goroutineList(g.Disappeared))
+		}
+		if len(g.WaitGrew) > 0 {
+			var grew []string
+			for _, wg := range g.WaitGrew {
+				grew = append(grew, fmt.Sprintf("%d [%s, %d -> %d minutes]", wg.After.ID, wg.After.State, wg.Before.WaitMinutes, wg.After.WaitMinutes))
+			}
+			fmt.Fprintf(w, "\twait grew: %s\n", strings.Join(grew, ", "))
+		}
+	}
+}
+
+func goroutineList(goroutines []*dump.Goroutine) string {
+	var list []string
+	for _, g := range goroutines {
+		list = append(list, fmt.Sprintf("%d [%s]", g.ID, g.State))
+	}
+	return strings.Join(list, ", ")
+}
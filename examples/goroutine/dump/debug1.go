@@ -0,0 +1,138 @@
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseDebug1 parses the output of pprof.Lookup("goroutine").WriteTo(w, 1),
+// which looks like this:
+//
+//	goroutine profile: total 6
+//	2 @ 0x103b125 0x106cd1f 0x13ac44a 0x106fd81
+//	# labels: {"test_label":"test_value"}
+//	#	0x106cd1e	time.Sleep+0xbe		/src/runtime/time.go:188
+//	#	0x13ac449	main.shortSleepLoop+0x29	/src/main.go:165
+//
+// The "@" line holds the return addresses of the stack, and the "#" lines
+// the functions of the call instructions. The runtime omits the functions of
+// leading runtime frames such as runtime.gopark, so the locations of those
+// addresses have no frames.
+func ParseDebug1(r io.Reader) (*Profile, error) {
+	p := &Profile{}
+	var (
+		sample *Sample
+		// locs maps the call addresses of sample to their locations.
+		locs = map[uint64]*Location{}
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		var err error
+		switch {
+		case lineNum == 1:
+			if !strings.HasPrefix(line, "goroutine profile: total ") {
+				err = fmt.Errorf("bad header: %q", line)
+			}
+		case line == "":
+			sample = nil
+		case strings.HasPrefix(line, "# labels: "):
+			if sample == nil {
+				err = fmt.Errorf("unexpected labels: %q", line)
+				break
+			}
+			sample.Labels, err = parseLabels(strings.TrimPrefix(line, "# labels: "), ":")
+		case strings.HasPrefix(line, "#\t"):
+			if sample == nil {
+				err = fmt.Errorf("unexpected frame: %q", line)
+				break
+			}
+			var (
+				addr  uint64
+				frame *Frame
+			)
+			if addr, frame, err = parseDebug1Frame(line[2:]); err != nil {
+				break
+			}
+			loc, ok := locs[addr]
+			if !ok {
+				err = fmt.Errorf("frame for unknown address %#x: %q", addr, line)
+				break
+			}
+			if frame != nil {
+				loc.Frames = append(loc.Frames, frame)
+			}
+		default:
+			sample, err = parseDebug1Sample(line)
+			if err != nil {
+				break
+			}
+			p.Samples = append(p.Samples, sample)
+			locs = map[uint64]*Location{}
+			for _, loc := range sample.Locations {
+				locs[loc.Address] = loc
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return p, scanner.Err()
+}
+
+// parseDebug1Sample parses a line like "2 @ 0x103b125 0x106cd1f". The
+// addresses are return addresses, so the address of the call instruction is
+// the one before.
+func parseDebug1Sample(line string) (*Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[1] != "@" {
+		return nil, fmt.Errorf("bad sample: %q", line)
+	}
+	count, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad sample: %q: %w", line, err)
+	}
+	s := &Sample{Count: count}
+	for _, field := range fields[2:] {
+		pc, err := strconv.ParseUint(strings.TrimPrefix(field, "0x"), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad sample: %q: %w", line, err)
+		}
+		s.Locations = append(s.Locations, &Location{Address: pc - 1})
+	}
+	return s, nil
+}
+
+// parseDebug1Frame parses the part of a line like
+// "#\t0x106cd1e\ttime.Sleep+0xbe\t\t/src/runtime/time.go:188" after "#\t".
+func parseDebug1Frame(line string) (uint64, *Frame, error) {
+	fields := strings.FieldsFunc(line, func(r rune) bool { return r == '\t' })
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("bad frame: %q", line)
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("bad frame: %q: %w", line, err)
+	} else if len(fields) == 1 {
+		// The runtime prints only the address if the function is unknown.
+		return addr, nil, nil
+	} else if len(fields) != 3 {
+		return 0, nil, fmt.Errorf("bad frame: %q", line)
+	}
+
+	frame := &Frame{Func: fields[1]}
+	if i := strings.LastIndex(frame.Func, "+0x"); i != -1 {
+		if frame.Offset, err = strconv.ParseUint(frame.Func[i+len("+0x"):], 16, 64); err != nil {
+			return 0, nil, fmt.Errorf("bad frame: %q: %w", line, err)
+		}
+		frame.Func = frame.Func[:i]
+	}
+	if err := parseFileLine(frame, fields[2]); err != nil {
+		return 0, nil, err
+	}
+	return addr, frame, nil
+}
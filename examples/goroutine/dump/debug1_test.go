@@ -0,0 +1,138 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestConvertDebug1 checks that converting the debug=1 fixtures produces the
+// same samples as the debug=0 fixtures taken at the same time.
+// 1.net.http.pprof.goroutine is not included, since the goroutine of the
+// previous HTTP request was still moving into its background read when the
+// debug=0 fixture was taken.
+func TestConvertDebug1(t *testing.T) {
+	for _, prefix := range []string{
+		"1.pprof.lookup.goroutine",
+		"2.pprof.lookup.goroutine",
+		"2.net.http.pprof.goroutine",
+	} {
+		t.Run(prefix, func(t *testing.T) {
+			debug1, err := os.Open(filepath.Join("..", prefix+".debug1.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer debug1.Close()
+			p, err := ParseDebug1(debug1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			if err := p.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := ParseDebug0(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			debug0, err := os.Open(filepath.Join("..", prefix+".debug0.pb.gz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer debug0.Close()
+			want, err := ParseDebug0(debug0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := comparableSamples(converted), comparableSamples(want); !reflect.DeepEqual(got, want) {
+				t.Errorf("samples don't match\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+// fixtureClosure matches the closures that wrote the fixtures, which differ
+// between the debug=0 and debug=1 fixtures.
+var fixtureClosure = regexp.MustCompile(`^main\.glob\.\.func\d+$`)
+
+// comparableSamples returns the samples of p as sorted strings. The leading
+// runtime frames that are hidden by the debug=1 format are removed, and the
+// closures that wrote the fixtures are replaced by a placeholder.
+func comparableSamples(p *Profile) []string {
+	var samples []string
+	for _, s := range p.Samples {
+		frames := s.Frames()
+		for len(frames) > 0 && strings.HasPrefix(frames[0].Func, "runtime.") {
+			frames = frames[1:]
+		}
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "%d %s\n", s.Count, labelsKey(s.Labels))
+		for _, f := range frames {
+			if fixtureClosure.MatchString(f.Func) {
+				fmt.Fprintf(b, "\t<writer>\n")
+				continue
+			}
+			fmt.Fprintf(b, "\t%s %s:%d\n", f.Func, f.File, f.Line)
+		}
+		samples = append(samples, b.String())
+	}
+	sort.Strings(samples)
+	return samples
+}
+
+func TestFromGoroutines(t *testing.T) {
+	for _, name := range debug2Fixtures {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			goroutines, err := ParseDebug2(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := FromGoroutines(goroutines)
+			if got, want := p.Total(), int64(len(goroutines)); got != want {
+				t.Errorf("total: got %d, want %d", got, want)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := p.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ParseDebug0(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := comparableSamples(decoded), comparableSamples(p); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip doesn't match\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for name, want := range map[string]Format{
+		"1.pprof.lookup.goroutine.debug0.pb.gz": FormatDebug0,
+		"1.pprof.lookup.goroutine.debug1.txt":   FormatDebug1,
+		"1.pprof.lookup.goroutine.debug2.txt":   FormatDebug2,
+		"1.runtime.stack.txt":                   FormatDebug2,
+	} {
+		p, got, err := ParseFile(filepath.Join("..", name))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		} else if p.Total() == 0 {
+			t.Errorf("%s: empty profile", name)
+		}
+	}
+}
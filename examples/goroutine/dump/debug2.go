@@ -0,0 +1,358 @@
+// Package dump parses the text formats of goroutine profiles and stack dumps.
+package dump
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Goroutine is a goroutine found in a dump.
+type Goroutine struct {
+	ID int64
+	// State is the status or wait reason of the goroutine, e.g. "running" or
+	// "chan receive".
+	State string
+	// WaitMinutes is the approximate time the goroutine has been blocked.
+	// The runtime omits it for waits shorter than a minute.
+	WaitMinutes int `json:",omitempty"`
+	// LockedToThread is true if the goroutine called runtime.LockOSThread.
+	LockedToThread bool `json:",omitempty"`
+	// Labels are the pprof labels of the goroutine. They're only included in
+	// dumps by recent Go versions with GODEBUG=tracebacklabels=1.
+	Labels map[string]string `json:",omitempty"`
+	// Frames holds the stack, starting with the innermost frame.
+	Frames []*Frame
+	// FramesElided is true if the runtime omitted frames because the stack
+	// is too deep.
+	FramesElided bool `json:",omitempty"`
+	// CreatedBy is the go statement that created the goroutine, or nil for
+	// the main goroutine and goroutines started by the runtime.
+	CreatedBy *Frame `json:",omitempty"`
+	// CreatorID is the id of the goroutine that created this one, or 0 if
+	// the dump is from Go 1.20 or older, which don't include it.
+	CreatorID int64 `json:",omitempty"`
+	// Ancestors are the goroutines that created this one, starting with its
+	// creator. They're only included with GODEBUG=tracebackancestors=N.
+	Ancestors []*Ancestor `json:",omitempty"`
+	// Truncated is true if the dump ended before the goroutine was complete,
+	// e.g. because the buffer passed to runtime.Stack was too small.
+	Truncated bool `json:",omitempty"`
+}
+
+// Ancestor is the stack of an ancestor goroutine at the time it created its
+// child.
+type Ancestor struct {
+	ID           int64
+	Frames       []*Frame
+	FramesElided bool   `json:",omitempty"`
+	CreatedBy    *Frame `json:",omitempty"`
+}
+
+// Frame is a single function call of a stack.
+type Frame struct {
+	// Func is the fully qualified function name, e.g.
+	// "net/http.(*Server).Serve".
+	Func string
+	// Args are the argument words printed by the runtime, e.g. "0x1", "{0x2,
+	// 0x3}" or "...". The runtime doesn't print args for "created by" frames
+	// and ancestors.
+	Args []string `json:",omitempty"`
+	File string
+	Line int
+	// Offset is the offset of the pc from the start of the function, or 0 if
+	// the dump doesn't include it.
+	Offset uint64 `json:",omitempty"`
+}
+
+// ParseDebug2 parses the output of pprof.Lookup("goroutine").WriteTo(w, 2)
+// or runtime.Stack(buf, true). Lines before the first goroutine, e.g. a panic
+// message, are ignored. A dump that ends in the middle of a goroutine is not
+// an error, but the goroutine is marked as truncated.
+func ParseDebug2(r io.Reader) ([]*Goroutine, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	// A complete dump ends with a newline, so the last element is either
+	// empty or a partial line.
+	partial := lines[len(lines)-1] != ""
+	lines = lines[:len(lines)-1]
+
+	p := &debug2Parser{}
+	for i, line := range lines {
+		if err := p.parseLine(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+	}
+	// The last goroutine of a dump is not followed by an empty line, so it's
+	// considered to be complete if it ends like a goroutine stack does.
+	if p.g != nil && (partial || !p.complete) {
+		p.g.Truncated = true
+	}
+	return p.goroutines, nil
+}
+
+type debug2Parser struct {
+	goroutines []*Goroutine
+	// g is the goroutine currently being parsed, or nil between goroutines.
+	g *Goroutine
+	// ancestor is the ancestor of g currently being parsed, or nil.
+	ancestor *Ancestor
+	// frame is the last frame, which is waiting for its file line.
+	frame *Frame
+	// complete is true if the last line was the file line of a "created by"
+	// frame or of main.main, which end the stacks of all goroutines.
+	complete bool
+}
+
+func (p *debug2Parser) parseLine(line string) error {
+	p.complete = false
+	if p.g == nil {
+		if !strings.HasPrefix(line, "goroutine ") || !strings.HasSuffix(line, ":") {
+			return nil
+		}
+		g, err := parseGoroutineHeader(line)
+		if err != nil {
+			return err
+		}
+		p.g, p.ancestor, p.frame = g, nil, nil
+		p.goroutines = append(p.goroutines, g)
+		return nil
+	}
+
+	switch {
+	case line == "":
+		p.g, p.ancestor, p.frame = nil, nil, nil
+	case line == "\tgoroutine running on other thread; stack unavailable":
+		// The stack of a goroutine running during a crash is unavailable.
+	case strings.HasPrefix(line, "\t"):
+		if p.frame == nil {
+			return fmt.Errorf("unexpected file line: %q", line)
+		}
+		if err := parseFileLine(p.frame, line[1:]); err != nil {
+			return err
+		}
+		p.complete = p.frame == p.g.CreatedBy || p.frame.Func == "main.main" ||
+			(p.ancestor != nil && p.frame == p.ancestor.CreatedBy)
+		p.frame = nil
+		return nil
+	case strings.HasPrefix(line, "created by "):
+		frame, creatorID, err := parseCreatedBy(line)
+		if err != nil {
+			return err
+		}
+		if p.ancestor != nil {
+			p.ancestor.CreatedBy = frame
+		} else {
+			p.g.CreatedBy, p.g.CreatorID = frame, creatorID
+		}
+		p.frame = frame
+	case strings.HasPrefix(line, "[originating from goroutine "):
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(line, "[originating from goroutine "), "]:"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad ancestor: %q: %w", line, err)
+		}
+		p.ancestor = &Ancestor{ID: id}
+		p.g.Ancestors = append(p.g.Ancestors, p.ancestor)
+		p.frame = nil
+	case strings.HasPrefix(line, "...") && strings.HasSuffix(line, "elided..."):
+		// "...additional frames elided..." or "...N frames elided...".
+		if p.ancestor != nil {
+			p.ancestor.FramesElided = true
+		} else {
+			p.g.FramesElided = true
+		}
+	default:
+		frame, err := parseFuncLine(line)
+		if err != nil {
+			return err
+		}
+		if p.ancestor != nil {
+			p.ancestor.Frames = append(p.ancestor.Frames, frame)
+		} else {
+			p.g.Frames = append(p.g.Frames, frame)
+		}
+		p.frame = frame
+	}
+	return nil
+}
+
+// parseGoroutineHeader parses a line like:
+//
+//	goroutine 22 [sleep, 1 minutes, locked to thread] {key: value}:
+//
+// Crash dumps might include additional fields such as "gp=0x..." before the
+// state, which are ignored.
+func parseGoroutineHeader(line string) (*Goroutine, error) {
+	open := strings.Index(line, " [")
+	end := strings.Index(line, "]")
+	if open == -1 || end < open {
+		return nil, fmt.Errorf("bad goroutine header: %q", line)
+	}
+	fields := strings.Fields(line[:open])
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("bad goroutine header: %q", line)
+	}
+	id, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad goroutine header: %q: %w", line, err)
+	}
+	g := &Goroutine{ID: id}
+
+	attrs := strings.Split(line[open+2:end], ", ")
+	g.State = attrs[0]
+	for _, attr := range attrs[1:] {
+		switch {
+		case attr == "locked to thread":
+			g.LockedToThread = true
+		case strings.HasSuffix(attr, " minutes"):
+			if g.WaitMinutes, err = strconv.Atoi(strings.TrimSuffix(attr, " minutes")); err != nil {
+				return nil, fmt.Errorf("bad wait duration: %q: %w", attr, err)
+			}
+		}
+	}
+
+	rest := strings.TrimSuffix(strings.TrimSpace(line[end+1:]), ":")
+	if rest != "" {
+		if g.Labels, err = parseLabels(rest, ": "); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// parseLabels parses labels of the form {key: value, "k 2": "v 2"}, where
+// sep separates keys and values. The debug=1 format always quotes keys and
+// values and uses ":" as sep, goroutine headers only quote them if they
+// contain special characters and use ": ".
+func parseLabels(s, sep string) (map[string]string, error) {
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("bad labels: %q", s)
+	}
+	labels := map[string]string{}
+	rest := s[1 : len(s)-1]
+	for rest != "" {
+		key, r, err := parseLabelString(rest, ':')
+		if err != nil {
+			return nil, fmt.Errorf("bad labels: %q: %w", s, err)
+		} else if !strings.HasPrefix(r, sep) {
+			return nil, fmt.Errorf("bad labels: %q: missing value for %q", s, key)
+		}
+		val, r, err := parseLabelString(r[len(sep):], ',')
+		if err != nil {
+			return nil, fmt.Errorf("bad labels: %q: %w", s, err)
+		}
+		labels[key] = val
+		rest = strings.TrimPrefix(r, ", ")
+	}
+	return labels, nil
+}
+
+// parseLabelString parses a quoted string or an unquoted string ending at
+// sep, and returns it along with the remainder of s.
+func parseLabelString(s string, sep byte) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", err
+		}
+		unquoted, err := strconv.Unquote(quoted)
+		return unquoted, s[len(quoted):], err
+	}
+	if i := strings.IndexByte(s, sep); i != -1 {
+		return s[:i], s[i:], nil
+	}
+	return s, "", nil
+}
+
+// parseFuncLine parses a line like "main.foo(0x1, {0x2, 0x3}, ...)". The
+// function name itself can contain parentheses, e.g. "pkg.(*T).Method", so
+// the args are the last parenthesized part of the line.
+func parseFuncLine(line string) (*Frame, error) {
+	if !strings.HasSuffix(line, ")") {
+		return nil, fmt.Errorf("bad function line: %q", line)
+	}
+	depth := 0
+	for i := len(line) - 1; i >= 0; i-- {
+		switch line[i] {
+		case ')', '}':
+			depth++
+		case '(', '{':
+			depth--
+		}
+		if depth == 0 {
+			return &Frame{Func: line[:i], Args: splitArgs(line[i+1 : len(line)-1])}, nil
+		}
+	}
+	return nil, fmt.Errorf("bad function line: %q", line)
+}
+
+// splitArgs splits args at the commas that are not nested in braces.
+func splitArgs(args string) []string {
+	if args == "" {
+		return nil
+	}
+	var split []string
+	depth, start := 0, 0
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				split = append(split, strings.TrimSpace(args[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(split, strings.TrimSpace(args[start:]))
+}
+
+// parseCreatedBy parses a line like "created by main.main in goroutine 1".
+// Go 1.20 and older don't include the creator goroutine, in which case the
+// returned id is 0.
+func parseCreatedBy(line string) (*Frame, int64, error) {
+	fn := strings.TrimPrefix(line, "created by ")
+	var creatorID int64
+	if i := strings.LastIndex(fn, " in goroutine "); i != -1 {
+		var err error
+		if creatorID, err = strconv.ParseInt(fn[i+len(" in goroutine "):], 10, 64); err != nil {
+			return nil, 0, fmt.Errorf("bad created by line: %q: %w", line, err)
+		}
+		fn = fn[:i]
+	}
+	return &Frame{Func: fn}, creatorID, nil
+}
+
+// parseFileLine parses the file line following a function line, e.g.
+// "/src/main.go:165 +0x2a". Crash dumps might include additional fields such
+// as "fp=0x..." after the offset, which are ignored.
+func parseFileLine(frame *Frame, line string) error {
+	if i := strings.LastIndex(line, " +0x"); i != -1 {
+		offset := line[i+len(" +0x"):]
+		if j := strings.IndexByte(offset, ' '); j != -1 {
+			offset = offset[:j]
+		}
+		var err error
+		if frame.Offset, err = strconv.ParseUint(offset, 16, 64); err != nil {
+			return fmt.Errorf("bad file line: %q: %w", line, err)
+		}
+		line = line[:i]
+	}
+	i := strings.LastIndexByte(line, ':')
+	if i == -1 {
+		return fmt.Errorf("bad file line: %q", line)
+	}
+	n, err := strconv.Atoi(line[i+1:])
+	if err != nil {
+		return fmt.Errorf("bad file line: %q: %w", line, err)
+	}
+	frame.File, frame.Line = line[:i], n
+	return nil
+}
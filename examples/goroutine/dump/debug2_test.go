@@ -0,0 +1,150 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata.")
+
+// debug2Fixtures are the dumps committed in the parent directory.
+var debug2Fixtures = []string{
+	"1.runtime.stack.txt",
+	"1.pprof.lookup.goroutine.debug2.txt",
+	"1.net.http.pprof.goroutine.debug2.txt",
+	"2.runtime.stack.txt",
+	"2.pprof.lookup.goroutine.debug2.txt",
+	"2.net.http.pprof.goroutine.debug2.txt",
+}
+
+func TestParseDebug2Golden(t *testing.T) {
+	for _, name := range debug2Fixtures {
+		t.Run(name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("..", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			goroutines, err := ParseDebug2(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(goroutines, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", name+".json")
+			if *update {
+				if err := ioutil.WriteFile(golden, append(got, '\n'), 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(append(got, '\n'), want) {
+				t.Errorf("%s doesn't match %s, run the test with -update if the change is intended", name, golden)
+			}
+		})
+	}
+}
+
+func TestParseDebug2Truncated(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "2.runtime.stack.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete, err := ParseDebug2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(data); n++ {
+		goroutines, err := ParseDebug2(bytes.NewReader(data[:n]))
+		if err != nil {
+			t.Fatalf("%d bytes: %s", n, err)
+		} else if len(goroutines) > len(complete) {
+			t.Fatalf("%d bytes: got %d goroutines, want <= %d", n, len(goroutines), len(complete))
+		}
+		// Goroutines that are not marked as truncated must be complete.
+		for i, g := range goroutines {
+			if g.ID != complete[i].ID {
+				t.Fatalf("%d bytes: goroutine %d: got id %d, want %d", n, i, g.ID, complete[i].ID)
+			} else if !g.Truncated && !reflect.DeepEqual(g, complete[i]) {
+				t.Fatalf("%d bytes: goroutine %d is incomplete, but not truncated", n, g.ID)
+			}
+		}
+	}
+}
+
+func TestParseDebug2(t *testing.T) {
+	dump := `panic: boom
+
+goroutine 7 gp=0xc000007a40 m=nil [chan receive (nil chan), 3 minutes, locked to thread] {request: "GET /", user_id: 42}:
+main.(*server).handle[...](0xc000010000, {0x1, 0x2}, ...)
+	/src/main.go:12 +0x1d fp=0xc00003e7d0 sp=0xc00003e7b0 pc=0x47b1dd
+...additional frames elided...
+created by main.main in goroutine 1
+	/src/main.go:30 +0x25
+[originating from goroutine 1]:
+main.main(...)
+	/src/main.go:29
+
+goroutine 8 [running]:
+	goroutine running on other thread; stack unavailable
+`
+	goroutines, err := ParseDebug2(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(goroutines) != 2 {
+		t.Fatalf("got %d goroutines, want 2", len(goroutines))
+	}
+
+	want := &Goroutine{
+		ID:             7,
+		State:          "chan receive (nil chan)",
+		WaitMinutes:    3,
+		LockedToThread: true,
+		Labels:         map[string]string{"request": "GET /", "user_id": "42"},
+		Frames: []*Frame{{
+			Func:   "main.(*server).handle[...]",
+			Args:   []string{"0xc000010000", "{0x1, 0x2}", "..."},
+			File:   "/src/main.go",
+			Line:   12,
+			Offset: 0x1d,
+		}},
+		FramesElided: true,
+		CreatedBy:    &Frame{Func: "main.main", File: "/src/main.go", Line: 30, Offset: 0x25},
+		CreatorID:    1,
+		Ancestors: []*Ancestor{{
+			ID:     1,
+			Frames: []*Frame{{Func: "main.main", Args: []string{"..."}, File: "/src/main.go", Line: 29}},
+		}},
+	}
+	if got := goroutines[0]; !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("got:\n%s\nwant:\n%s", gotJSON, wantJSON)
+	}
+	if g := goroutines[1]; g.ID != 8 || g.State != "running" || len(g.Frames) != 0 {
+		t.Errorf("unexpected goroutine: %+v", g)
+	}
+}
+
+func TestParseDebug2BadHeader(t *testing.T) {
+	for _, dump := range []string{
+		"goroutine [running]:\n",
+		"goroutine x [running]:\n",
+		"goroutine 1 running]:\n",
+	} {
+		if _, err := ParseDebug2(strings.NewReader(dump)); err == nil {
+			t.Errorf("%q: expected error", dump)
+		}
+	}
+}
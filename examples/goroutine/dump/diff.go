@@ -0,0 +1,135 @@
+package dump
+
+import (
+	"sort"
+	"strings"
+)
+
+// DiffGroup is a group of goroutines with the same stack and creator that
+// changed between two profiles.
+type DiffGroup struct {
+	// Frames is the stack of the group without leading and trailing runtime
+	// frames such as runtime.gopark and runtime.main, since not all formats
+	// include them.
+	Frames []*Frame
+	// CreatedBy is the go statement that created the goroutines. It's only
+	// known if both profiles were created from the debug=2 format.
+	CreatedBy *Frame `json:",omitempty"`
+	// Before and After are the number of goroutines of the group in both
+	// profiles.
+	Before, After int64
+	// Appeared and Disappeared are the goroutines only found in the after or
+	// the before profile, and WaitGrew the ones found in both whose wait time
+	// grew. They're only known if both profiles were created from the debug=2
+	// format, otherwise only the counts are compared.
+	Appeared    []*Goroutine  `json:",omitempty"`
+	Disappeared []*Goroutine  `json:",omitempty"`
+	WaitGrew    []*WaitGrowth `json:",omitempty"`
+}
+
+// WaitGrowth is a goroutine whose wait time grew between two profiles.
+type WaitGrowth struct {
+	Before, After *Goroutine
+}
+
+// Delta returns the change of the number of goroutines of g.
+func (g *DiffGroup) Delta() int64 {
+	return g.After - g.Before
+}
+
+// Diff compares the goroutines of two profiles of the same program, and
+// returns the groups of goroutines that changed, ordered by Delta so that
+// leaks come first. Goroutines are matched by their ID, so a goroutine whose
+// stack changed disappears from its old group and appears in its new one.
+func Diff(before, after *Profile) []*DiffGroup {
+	byGoroutine := before.Goroutines != nil && after.Goroutines != nil
+
+	type group struct {
+		*DiffGroup
+		before, after []*Goroutine
+	}
+	var (
+		groups  = map[string]*group{}
+		ordered []*group
+	)
+	lookup := func(frames []*Frame, createdBy *Frame) *group {
+		frames = trimRuntimeFrames(frames)
+		key := stackKey(frames)
+		if createdBy != nil {
+			key += "created by " + stackKey([]*Frame{createdBy})
+		}
+		if g, ok := groups[key]; ok {
+			return g
+		}
+		g := &group{DiffGroup: &DiffGroup{Frames: frames, CreatedBy: createdBy}}
+		groups[key] = g
+		ordered = append(ordered, g)
+		return g
+	}
+
+	if byGoroutine {
+		for _, gr := range before.Goroutines {
+			g := lookup(gr.Frames, gr.CreatedBy)
+			g.Before++
+			g.before = append(g.before, gr)
+		}
+		for _, gr := range after.Goroutines {
+			g := lookup(gr.Frames, gr.CreatedBy)
+			g.After++
+			g.after = append(g.after, gr)
+		}
+	} else {
+		for _, s := range before.Samples {
+			lookup(s.Frames(), nil).Before += s.Count
+		}
+		for _, s := range after.Samples {
+			lookup(s.Frames(), nil).After += s.Count
+		}
+	}
+
+	var result []*DiffGroup
+	for _, g := range ordered {
+		beforeIDs := map[int64]*Goroutine{}
+		for _, gr := range g.before {
+			beforeIDs[gr.ID] = gr
+		}
+		afterIDs := map[int64]bool{}
+		for _, gr := range g.after {
+			afterIDs[gr.ID] = true
+			if b, ok := beforeIDs[gr.ID]; !ok {
+				g.Appeared = append(g.Appeared, gr)
+			} else if gr.WaitMinutes > b.WaitMinutes {
+				g.WaitGrew = append(g.WaitGrew, &WaitGrowth{Before: b, After: gr})
+			}
+		}
+		for _, gr := range g.before {
+			if !afterIDs[gr.ID] {
+				g.Disappeared = append(g.Disappeared, gr)
+			}
+		}
+
+		if g.Delta() != 0 || len(g.Appeared) > 0 || len(g.Disappeared) > 0 || len(g.WaitGrew) > 0 {
+			result = append(result, g.DiffGroup)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Delta() != result[j].Delta() {
+			return result[i].Delta() > result[j].Delta()
+		}
+		return len(result[i].WaitGrew) > len(result[j].WaitGrew)
+	})
+	return result
+}
+
+// trimRuntimeFrames returns frames without leading and trailing frames of
+// the runtime package.
+func trimRuntimeFrames(frames []*Frame) []*Frame {
+	isRuntime := func(f *Frame) bool { return strings.HasPrefix(f.Func, "runtime.") }
+	for len(frames) > 0 && isRuntime(frames[0]) {
+		frames = frames[1:]
+	}
+	for len(frames) > 0 && isRuntime(frames[len(frames)-1]) {
+		frames = frames[:len(frames)-1]
+	}
+	return frames
+}
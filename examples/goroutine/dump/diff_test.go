@@ -0,0 +1,70 @@
+package dump
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	parse := func(name string) *Profile {
+		t.Helper()
+		p, _, err := ParseFile(filepath.Join("..", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	t.Run("debug2", func(t *testing.T) {
+		groups := Diff(parse("1.runtime.stack.txt"), parse("2.runtime.stack.txt"))
+		var appeared, disappeared []int64
+		grew := map[int64]string{}
+		for _, g := range groups {
+			for _, gr := range g.Appeared {
+				appeared = append(appeared, gr.ID)
+			}
+			for _, gr := range g.Disappeared {
+				disappeared = append(disappeared, gr.ID)
+			}
+			for _, wg := range g.WaitGrew {
+				if g.CreatedBy == nil {
+					t.Fatalf("goroutine %d: missing creator", wg.After.ID)
+				}
+				grew[wg.After.ID] = g.CreatedBy.Func
+			}
+		}
+		// The main goroutine is writing a different profile in both dumps, so
+		// its stack changed.
+		if got, want := len(appeared), 4; got != want {
+			t.Errorf("appeared: got %v, want %d goroutines", appeared, want)
+		} else if got, want := disappeared, []int64{1}; len(got) != 1 || got[0] != want[0] {
+			t.Errorf("disappeared: got %v, want %v", got, want)
+		} else if got, want := grew[22], "main.indirectShortSleepLoop2"; got != want {
+			t.Errorf("goroutine 22: got creator %q, want %q", got, want)
+		} else if got, want := len(grew), 5; got != want {
+			t.Errorf("wait grew: got %v, want %d goroutines", grew, want)
+		}
+	})
+
+	t.Run("counts", func(t *testing.T) {
+		before := parse("1.pprof.lookup.goroutine.debug1.txt")
+		after := parse("2.pprof.lookup.goroutine.debug0.pb.gz")
+		var delta int64
+		for _, g := range Diff(before, after) {
+			if len(g.Appeared)+len(g.Disappeared)+len(g.WaitGrew) > 0 {
+				t.Errorf("got goroutines without debug=2 profiles: %+v", g)
+			}
+			delta += g.Delta()
+		}
+		if got, want := delta, after.Total()-before.Total(); got != want {
+			t.Errorf("delta: got %d, want %d", got, want)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		p := parse("2.runtime.stack.txt")
+		if groups := Diff(p, p); len(groups) != 0 {
+			t.Errorf("got %d groups, want none", len(groups))
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile is a goroutine profile that aggregates goroutines with the same
+// stack and labels into samples. It's the common representation of all
+// formats, and can be written as a profile.proto that can be loaded by
+// `go tool pprof`.
+type Profile struct {
+	// Time is when the profile was taken, or zero if it's unknown.
+	Time    time.Time
+	Samples []*Sample
+	// Goroutines holds the individual goroutines if the profile was created
+	// from the debug=2 format, which is the only one that includes them.
+	Goroutines []*Goroutine `json:",omitempty"`
+}
+
+// Sample is a group of goroutines with the same stack and labels.
+type Sample struct {
+	Count     int64
+	Locations []*Location
+	Labels    map[string]string `json:",omitempty"`
+}
+
+// Location is a single pc of a stack, starting with the innermost location.
+type Location struct {
+	// Address is the address of the call instruction, or 0 if it's unknown
+	// because the profile was converted from the debug=2 format.
+	Address uint64 `json:",omitempty"`
+	// Frames holds the function calls at Address, which are more than one
+	// if functions were inlined, starting with the innermost one. It's empty
+	// if the function is unknown, e.g. for runtime functions that are hidden
+	// by the debug=1 format.
+	Frames []*Frame `json:",omitempty"`
+}
+
+// Total returns the number of goroutines in the profile.
+func (p *Profile) Total() int64 {
+	var total int64
+	for _, s := range p.Samples {
+		total += s.Count
+	}
+	return total
+}
+
+// Frames returns the frames of all locations of s, starting with the
+// innermost frame.
+func (s *Sample) Frames() []*Frame {
+	var frames []*Frame
+	for _, loc := range s.Locations {
+		frames = append(frames, loc.Frames...)
+	}
+	return frames
+}
+
+// FromGoroutines returns a profile with a sample for every group of
+// goroutines with identical frames and labels, in the order in which the
+// groups first appear. Args and pc offsets are ignored, since they don't
+// identify the call site.
+func FromGoroutines(goroutines []*Goroutine) *Profile {
+	p := &Profile{Goroutines: goroutines}
+	samples := map[string]*Sample{}
+	for _, g := range goroutines {
+		key := stackKey(g.Frames) + labelsKey(g.Labels)
+		if s, ok := samples[key]; ok {
+			s.Count++
+			continue
+		}
+		s := &Sample{Count: 1, Labels: g.Labels}
+		for _, f := range g.Frames {
+			s.Locations = append(s.Locations, &Location{
+				Frames: []*Frame{{Func: f.Func, File: f.File, Line: f.Line}},
+			})
+		}
+		samples[key] = s
+		p.Samples = append(p.Samples, s)
+	}
+	return p
+}
+
+// stackKey returns a string identifying the call sites of frames.
+func stackKey(frames []*Frame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%s %s:%d\n", f.Func, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// labelsKey returns a string identifying labels.
+func labelsKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(labels) {
+		fmt.Fprintf(&b, "%q:%q\n", k, labels[k])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Format is a format of goroutine profiles or dumps.
+type Format string
+
+// Formats supported by ParseFile.
+const (
+	FormatDebug0 Format = "debug0"
+	FormatDebug1 Format = "debug1"
+	// FormatDebug2 is also produced by runtime.Stack.
+	FormatDebug2 Format = "debug2"
+)
+
+// DetectFormat returns the format of the profile or dump in data.
+func DetectFormat(data []byte) (Format, error) {
+	switch text := bytes.TrimLeft(data, "\n"); {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return FormatDebug0, nil
+	case bytes.HasPrefix(text, []byte("goroutine profile: total ")):
+		return FormatDebug1, nil
+	case bytes.HasPrefix(text, []byte("goroutine ")) || bytes.Contains(text, []byte("\ngoroutine ")):
+		return FormatDebug2, nil
+	}
+	return "", fmt.Errorf("unknown goroutine profile format")
+}
+
+// ParseFile parses the profile or dump at path in any of the supported
+// formats.
+func ParseFile(path string) (*Profile, Format, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	p, format, err := Parse(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return p, format, nil
+}
+
+// Parse parses the profile or dump in data in any of the supported formats.
+func Parse(data []byte) (*Profile, Format, error) {
+	format, err := DetectFormat(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var p *Profile
+	switch format {
+	case FormatDebug0:
+		p, err = ParseDebug0(bytes.NewReader(data))
+	case FormatDebug1:
+		p, err = ParseDebug1(bytes.NewReader(data))
+	case FormatDebug2:
+		var goroutines []*Goroutine
+		if goroutines, err = ParseDebug2(bytes.NewReader(data)); err == nil {
+			p = FromGoroutines(goroutines)
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return p, format, nil
+}
@@ -0,0 +1,432 @@
+package dump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// The encoding and decoding of profile.proto is implemented by hand, see
+// profile.proto in the root of this repository, which allows the examples to
+// remain free of dependencies. Only the fields used by goroutine profiles are
+// supported.
+
+// Write writes p as a gzip compressed profile.proto, like the debug=0 format.
+// Locations without an address, e.g. from profiles converted from the debug=2
+// format, get a unique fake address since pprof merges locations with the
+// same address.
+func (p *Profile) Write(w io.Writer) error {
+	var (
+		st                   = &stringTable{indices: map[string]int64{"": 0}, strings: []string{""}}
+		samples, locs, funcs protoEncoder
+		funcIDs              = map[string]uint64{}
+		locIDs               = map[string]uint64{}
+	)
+	funcID := func(f *Frame) uint64 {
+		key := f.Func + "\x00" + f.File
+		if id, ok := funcIDs[key]; ok {
+			return id
+		}
+		id := uint64(len(funcIDs) + 1)
+		funcIDs[key] = id
+		funcs.message(5, func(e *protoEncoder) {
+			e.uint64(1, id)
+			e.int64(2, st.index(f.Func))
+			e.int64(3, st.index(f.Func))
+			e.int64(4, st.index(f.File))
+		})
+		return id
+	}
+	locID := func(loc *Location) uint64 {
+		key := fmt.Sprintf("%#x", loc.Address)
+		if loc.Address == 0 {
+			key = stackKey(loc.Frames)
+		}
+		if id, ok := locIDs[key]; ok {
+			return id
+		}
+		id := uint64(len(locIDs) + 1)
+		locIDs[key] = id
+		addr := loc.Address
+		if addr == 0 {
+			addr = id
+		}
+		locs.message(4, func(e *protoEncoder) {
+			e.uint64(1, id)
+			e.uint64(2, 1) // mapping_id
+			e.uint64(3, addr)
+			for _, f := range loc.Frames {
+				fid := funcID(f)
+				e.message(4, func(e *protoEncoder) {
+					e.uint64(1, fid)
+					e.int64(2, int64(f.Line))
+				})
+			}
+		})
+		return id
+	}
+
+	for _, s := range p.Samples {
+		var ids []uint64
+		for _, loc := range s.Locations {
+			ids = append(ids, locID(loc))
+		}
+		samples.message(2, func(e *protoEncoder) {
+			e.packed(1, ids)
+			e.packed(2, []uint64{uint64(s.Count)})
+			for _, k := range sortedKeys(s.Labels) {
+				k, v := k, s.Labels[k]
+				e.message(3, func(e *protoEncoder) {
+					e.int64(1, st.index(k))
+					e.int64(2, st.index(v))
+				})
+			}
+		})
+	}
+
+	var out protoEncoder
+	valueType := func(e *protoEncoder) {
+		e.int64(1, st.index("goroutine"))
+		e.int64(2, st.index("count"))
+	}
+	out.message(1, valueType) // sample_type
+	out.buf.Write(samples.buf.Bytes())
+	out.message(3, func(e *protoEncoder) {
+		e.uint64(1, 1)
+		e.uint64(7, 1) // has_functions
+	})
+	out.buf.Write(locs.buf.Bytes())
+	out.buf.Write(funcs.buf.Bytes())
+	if !p.Time.IsZero() {
+		out.int64(9, p.Time.UnixNano())
+	}
+	out.message(11, valueType) // period_type
+	out.int64(12, 1)           // period
+	// The string table must be written after all strings have been added.
+	for _, s := range st.strings {
+		out.bytes(6, []byte(s))
+	}
+
+	gw := gzip.NewWriter(w)
+	if _, err := gw.Write(out.buf.Bytes()); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// stringTable is the string table of a profile being encoded.
+type stringTable struct {
+	indices map[string]int64
+	strings []string
+}
+
+// index returns the index of s, adding it to the table if needed.
+func (t *stringTable) index(s string) int64 {
+	if i, ok := t.indices[s]; ok {
+		return i
+	}
+	i := int64(len(t.strings))
+	t.indices[s] = i
+	t.strings = append(t.strings, s)
+	return i
+}
+
+// protoEncoder writes the fields of a protobuf message.
+type protoEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *protoEncoder) key(field int, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+// uint64 writes a varint field, unless v is the default value 0.
+func (e *protoEncoder) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.key(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *protoEncoder) int64(field int, v int64) {
+	e.uint64(field, uint64(v))
+}
+
+func (e *protoEncoder) bytes(field int, b []byte) {
+	e.key(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *protoEncoder) packed(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed protoEncoder
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	e.bytes(field, packed.buf.Bytes())
+}
+
+func (e *protoEncoder) message(field int, fn func(e *protoEncoder)) {
+	var m protoEncoder
+	fn(&m)
+	e.bytes(field, m.buf.Bytes())
+}
+
+// ParseDebug0 decodes a gzip compressed or uncompressed goroutine profile in
+// the profile.proto format.
+func ParseDebug0(r io.Reader) (*Profile, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(gr); err != nil {
+			return nil, err
+		}
+	}
+
+	type rawLine struct {
+		funcID uint64
+		line   int64
+	}
+	type rawFunc struct {
+		name, file int64
+	}
+	type rawLabel struct {
+		key, str int64
+	}
+	type rawSample struct {
+		locationIDs []uint64
+		values      []int64
+		labels      []rawLabel
+	}
+	var (
+		samples     []rawSample
+		locations   = map[uint64]*Location{}
+		locLines    = map[uint64][]rawLine{}
+		functions   = map[uint64]rawFunc{}
+		stringTable []string
+		timeNanos   int64
+	)
+
+	err = decodeMessage(data, func(field, wireType int, v uint64, b []byte) error {
+		switch field {
+		case 2: // sample
+			var s rawSample
+			err := decodeMessage(b, func(field, wireType int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					return decodeRepeated(wireType, v, b, func(v uint64) { s.locationIDs = append(s.locationIDs, v) })
+				case 2:
+					return decodeRepeated(wireType, v, b, func(v uint64) { s.values = append(s.values, int64(v)) })
+				case 3:
+					var l rawLabel
+					err := decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+						switch field {
+						case 1:
+							l.key = int64(v)
+						case 2:
+							l.str = int64(v)
+						}
+						return nil
+					})
+					s.labels = append(s.labels, l)
+					return err
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case 4: // location
+			var (
+				id    uint64
+				loc   = &Location{}
+				lines []rawLine
+			)
+			err := decodeMessage(b, func(field, _ int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 3:
+					loc.Address = v
+				case 4:
+					var l rawLine
+					err := decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+						switch field {
+						case 1:
+							l.funcID = v
+						case 2:
+							l.line = int64(v)
+						}
+						return nil
+					})
+					lines = append(lines, l)
+					return err
+				}
+				return nil
+			})
+			locations[id], locLines[id] = loc, lines
+			return err
+		case 5: // function
+			var (
+				id uint64
+				f  rawFunc
+			)
+			err := decodeMessage(b, func(field, _ int, v uint64, _ []byte) error {
+				switch field {
+				case 1:
+					id = v
+				case 2:
+					f.name = int64(v)
+				case 4:
+					f.file = int64(v)
+				}
+				return nil
+			})
+			functions[id] = f
+			return err
+		case 6: // string_table
+			stringTable = append(stringTable, string(b))
+		case 9: // time_nanos
+			timeNanos = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(stringTable)) {
+			return ""
+		}
+		return stringTable[i]
+	}
+	for id, loc := range locations {
+		for _, l := range locLines[id] {
+			f := functions[l.funcID]
+			loc.Frames = append(loc.Frames, &Frame{Func: str(f.name), File: str(f.file), Line: int(l.line)})
+		}
+	}
+
+	p := &Profile{}
+	if timeNanos != 0 {
+		p.Time = time.Unix(0, timeNanos)
+	}
+	for _, s := range samples {
+		if len(s.values) != 1 {
+			return nil, fmt.Errorf("%w: got %d values per sample, want 1", errBadProto, len(s.values))
+		}
+		sample := &Sample{Count: s.values[0]}
+		for _, id := range s.locationIDs {
+			loc, ok := locations[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown location id %d", errBadProto, id)
+			}
+			sample.Locations = append(sample.Locations, loc)
+		}
+		for _, l := range s.labels {
+			if sample.Labels == nil {
+				sample.Labels = map[string]string{}
+			}
+			sample.Labels[str(l.key)] = str(l.str)
+		}
+		p.Samples = append(p.Samples, sample)
+	}
+	return p, nil
+}
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wire64Bit  = 1
+	wireBytes  = 2
+	wire32Bit  = 5
+)
+
+var errBadProto = errors.New("bad protobuf encoding")
+
+// decodeMessage calls fn for every field of the protobuf message in data. For
+// varint and fixed size fields v holds the value, for length-delimited fields
+// b holds the payload.
+func decodeMessage(data []byte, fn func(field, wireType int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errBadProto
+		}
+		data = data[n:]
+
+		var (
+			field    = int(key >> 3)
+			wireType = int(key & 7)
+			v        uint64
+			b        []byte
+		)
+		switch wireType {
+		case wireVarint:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errBadProto
+			}
+			data = data[n:]
+		case wire64Bit:
+			if len(data) < 8 {
+				return errBadProto
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return errBadProto
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		case wire32Bit:
+			if len(data) < 4 {
+				return errBadProto
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("%w: unsupported wire type %d", errBadProto, wireType)
+		}
+		if err := fn(field, wireType, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRepeated calls fn for every value of a repeated varint field, which
+// may either be packed or not.
+func decodeRepeated(wireType int, v uint64, b []byte, fn func(uint64)) error {
+	if wireType != wireBytes {
+		fn(v)
+		return nil
+	}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBadProto
+		}
+		fn(v)
+		b = b[n:]
+	}
+	return nil
+}
@@ -1,121 +1,53 @@
 package main
 
 import (
-	"bytes"
+	"archive/tar"
 	"context"
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"time"
+
+	"github.com/felixge/go-profiler-notes/examples/goroutine/snapshot"
 )
 
-type Profile struct {
-	Name    string
-	WriteTo func(w io.Writer) error
-}
+var listenAddr = "127.0.0.1:8080"
 
-var profiles = []Profile{
-	{
-		Name: "runtime.stack.txt",
-		WriteTo: func(w io.Writer) error {
-			buf := make([]byte, 1024*1024)
-			n := runtime.Stack(buf, true)
-			buf = buf[:n]
-			_, err := w.Write(buf)
-			return err
-		},
-	},
-	{
-		Name: "runtime.goroutineprofile.json",
-		WriteTo: func(w io.Writer) error {
-			p := make([]runtime.StackRecord, 1000)
-			n, ok := runtime.GoroutineProfile(p)
-			if !ok {
-				return errors.New("runtime.GoroutineProfile: not ok")
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
 			}
-			p = p[0:n]
-			e := json.NewEncoder(w)
-			e.SetIndent("", "  ")
-			return e.Encode(p)
-		},
-	},
-	{
-		Name: "pprof.lookup.goroutine.debug0.pb.gz",
-		WriteTo: func(w io.Writer) error {
-			profile := pprof.Lookup("goroutine")
-			return profile.WriteTo(w, 0)
-		},
-	},
-	{
-		Name: "pprof.lookup.goroutine.debug1.txt",
-		WriteTo: func(w io.Writer) error {
-			profile := pprof.Lookup("goroutine")
-			return profile.WriteTo(w, 1)
-		},
-	},
-	{
-		Name: "pprof.lookup.goroutine.debug2.txt",
-		WriteTo: func(w io.Writer) error {
-			profile := pprof.Lookup("goroutine")
-			return profile.WriteTo(w, 2)
-		},
-	},
-	{
-		Name: "net.http.pprof.goroutine.debug0.pb.gz",
-		WriteTo: func(w io.Writer) error {
-			return writeHttpProfile(w, 0)
-		},
-	},
-	{
-		Name: "net.http.pprof.goroutine.debug1.txt",
-		WriteTo: func(w io.Writer) error {
-			return writeHttpProfile(w, 1)
-		},
-	},
-	{
-		Name: "net.http.pprof.goroutine.debug2.txt",
-		WriteTo: func(w io.Writer) error {
-			return writeHttpProfile(w, 2)
-		},
-	},
-}
-
-func writeHttpProfile(w io.Writer, debug int) error {
-	url := fmt.Sprintf("http://%s/debug/pprof/goroutine?debug=%d", listenAddr, debug)
-	res, err := http.Get(url)
-	if err != nil {
-		return err
+			return
+		}
 	}
-	defer res.Body.Close()
 
-	_, err = io.Copy(w, res.Body)
-	return err
-}
+	out := flag.String("out", ".", "The directory to write the snapshots to, or a path ending in .tar for writing them into a tar archive.")
+	flag.Parse()
 
-func writeProfiles(n int) error {
-	for _, profile := range profiles {
-		buf := &bytes.Buffer{}
-		filename := fmt.Sprintf("%d.%s", n, profile.Name)
-		if err := profile.WriteTo(buf); err != nil {
-			return err
-		} else if err := ioutil.WriteFile(filename, buf.Bytes(), 0666); err != nil {
+	snapshotter := &snapshot.Snapshotter{
+		Profiles: append(append([]snapshot.Profile{}, snapshot.Profiles...), snapshot.HTTPProfiles(listenAddr)...),
+	}
+	var snaps []*snapshot.Snapshot
+	writeSnapshot := func() error {
+		snap, err := snapshotter.Take()
+		if err != nil {
 			return err
+		} else if !strings.HasSuffix(*out, ".tar") {
+			return snap.WriteDir(*out)
 		}
+		// The program never exits, so the archive is rewritten with all
+		// snapshots every time.
+		snaps = append(snaps, snap)
+		return writeTar(*out, snaps)
 	}
-	return nil
-}
-
-var listenAddr = "127.0.0.1:8080"
-
-func main() {
-	flag.Parse()
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -123,14 +55,7 @@ func main() {
 		errCh <- http.ListenAndServe(listenAddr, nil)
 	}()
 
-	labels := pprof.Labels("test_label", "test_value")
-	ctx := pprof.WithLabels(context.Background(), labels)
-	pprof.SetGoroutineLabels(ctx)
-
-	go shortSleepLoop()
-	go sleepLoop(time.Hour)
-	go chanReceiveForever()
-	go indirectShortSleepLoop()
+	startGoroutines()
 
 	sleep := time.Second
 	fmt.Printf("Sleeping for %s followed by gc\n", sleep)
@@ -139,7 +64,7 @@ func main() {
 	runtime.GC()
 
 	fmt.Printf("Dump 1\n")
-	if err := writeProfiles(1); err != nil {
+	if err := writeSnapshot(); err != nil {
 		panic(err)
 	}
 
@@ -149,7 +74,7 @@ func main() {
 	runtime.GC()
 
 	fmt.Printf("Dump 2\n")
-	if err := writeProfiles(2); err != nil {
+	if err := writeSnapshot(); err != nil {
 		panic(err)
 	}
 
@@ -160,6 +85,38 @@ func main() {
 	<-errCh
 }
 
+// startGoroutines labels the calling goroutine and starts the goroutines that
+// are captured by the snapshots, which inherit the labels.
+func startGoroutines() {
+	labels := pprof.Labels("test_label", "test_value")
+	ctx := pprof.WithLabels(context.Background(), labels)
+	pprof.SetGoroutineLabels(ctx)
+
+	go shortSleepLoop()
+	go sleepLoop(time.Hour)
+	go chanReceiveForever()
+	go indirectShortSleepLoop()
+}
+
+func writeTar(path string, snaps []*snapshot.Snapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, snap := range snaps {
+		if err := snap.WriteTar(tw); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 func shortSleepLoop() {
 	for {
 		time.Sleep(time.Second)
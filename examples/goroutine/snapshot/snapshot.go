@@ -0,0 +1,366 @@
+// Package snapshot captures the goroutines of the current program in all the
+// formats offered by the Go runtime, so that they can be compared with each
+// other.
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is a format in which the goroutines can be captured.
+type Profile struct {
+	// Name is used as the file name of the profile, prefixed by the sequence
+	// number of the snapshot.
+	Name    string
+	WriteTo func(w io.Writer) error
+}
+
+// Profiles are all formats that can be captured without going through
+// net/http/pprof.
+var Profiles = []Profile{
+	{
+		Name: "runtime.stack.txt",
+		WriteTo: func(w io.Writer) error {
+			_, err := w.Write(allStacks())
+			return err
+		},
+	},
+	{
+		Name: "runtime.goroutineprofile.json",
+		WriteTo: func(w io.Writer) error {
+			e := json.NewEncoder(w)
+			e.SetIndent("", "  ")
+			return e.Encode(goroutineProfile())
+		},
+	},
+	{
+		Name: "pprof.lookup.goroutine.debug0.pb.gz",
+		WriteTo: func(w io.Writer) error {
+			return pprof.Lookup("goroutine").WriteTo(w, 0)
+		},
+	},
+	{
+		Name: "pprof.lookup.goroutine.debug1.txt",
+		WriteTo: func(w io.Writer) error {
+			return pprof.Lookup("goroutine").WriteTo(w, 1)
+		},
+	},
+	{
+		Name: "pprof.lookup.goroutine.debug2.txt",
+		WriteTo: func(w io.Writer) error {
+			return pprof.Lookup("goroutine").WriteTo(w, 2)
+		},
+	},
+}
+
+// HTTPProfiles returns the formats served by the net/http/pprof handlers of
+// the server listening on addr, e.g. "127.0.0.1:8080".
+func HTTPProfiles(addr string) []Profile {
+	var profiles []Profile
+	for debug, ext := range []string{"pb.gz", "txt", "txt"} {
+		debug := debug
+		profiles = append(profiles, Profile{
+			Name: fmt.Sprintf("net.http.pprof.goroutine.debug%d.%s", debug, ext),
+			WriteTo: func(w io.Writer) error {
+				return writeHTTPProfile(w, addr, debug)
+			},
+		})
+	}
+	return profiles
+}
+
+func writeHTTPProfile(w io.Writer, addr string, debug int) error {
+	url := fmt.Sprintf("http://%s/debug/pprof/goroutine?debug=%d", addr, debug)
+	res, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// allStacks returns the output of runtime.Stack for all goroutines, growing
+// the buffer until it fits.
+func allStacks() []byte {
+	buf := make([]byte, 1024*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineProfile returns the result of runtime.GoroutineProfile, growing the
+// slice until all goroutines fit.
+func goroutineProfile() []runtime.StackRecord {
+	p := make([]runtime.StackRecord, runtime.NumGoroutine()+10)
+	for {
+		n, ok := runtime.GoroutineProfile(p)
+		if ok {
+			return p[:n]
+		}
+		// More goroutines might have been started in the meantime.
+		p = make([]runtime.StackRecord, n+n/2)
+	}
+}
+
+// Snapshotter takes snapshots of the goroutines and numbers them.
+type Snapshotter struct {
+	// Profiles are the formats included in every snapshot. Profiles is used
+	// if it's nil.
+	Profiles []Profile
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Take captures all profiles one after another and returns them as a
+// snapshot with the next sequence number, starting at 1. The goroutines can
+// change while the profiles are being captured, so they're not guaranteed to
+// be identical in all formats.
+func (s *Snapshotter) Take() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := s.Profiles
+	if profiles == nil {
+		profiles = Profiles
+	}
+
+	s.seq++
+	snap := &Snapshot{Seq: s.seq, Time: time.Now(), Goroutines: runtime.NumGoroutine()}
+	for _, p := range profiles {
+		buf := &bytes.Buffer{}
+		if err := p.WriteTo(buf); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		snap.Files = append(snap.Files, File{Name: p.Name, Data: buf.Bytes()})
+	}
+	snap.Duration = time.Since(snap.Time)
+	return snap, nil
+}
+
+// Snapshot holds the goroutines captured in several formats by a single call
+// to Snapshotter.Take.
+type Snapshot struct {
+	// Seq is the sequence number of the snapshot.
+	Seq int
+	// Time is when capturing the profiles began.
+	Time time.Time
+	// Duration is how long it took to capture all profiles.
+	Duration time.Duration
+	// Goroutines is the number of goroutines when capturing began.
+	Goroutines int
+	// Files holds the profiles in the order they were captured.
+	Files []File
+}
+
+// File is a profile captured by a snapshot.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// metaName is the name of the file describing the snapshot.
+const metaName = "snapshot.json"
+
+type snapshotMeta struct {
+	Seq        int       `json:"seq"`
+	Time       time.Time `json:"time"`
+	DurationNs int64     `json:"duration_ns"`
+	Goroutines int       `json:"goroutines"`
+	Files      []string  `json:"files"`
+}
+
+// FileName returns the name under which f is written, e.g.
+// "1.runtime.stack.txt" for the first snapshot.
+func (s *Snapshot) FileName(f File) string {
+	return fmt.Sprintf("%d.%s", s.Seq, f.Name)
+}
+
+// files returns the profiles and a file describing the snapshot.
+func (s *Snapshot) files() ([]File, error) {
+	meta := snapshotMeta{
+		Seq:        s.Seq,
+		Time:       s.Time,
+		DurationNs: s.Duration.Nanoseconds(),
+		Goroutines: s.Goroutines,
+	}
+	for _, f := range s.Files {
+		meta.Files = append(meta.Files, s.FileName(f))
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]File{{Name: metaName, Data: append(data, '\n')}}, s.Files...), nil
+}
+
+// WriteDir writes every profile and a snapshot.json file with the sequence
+// number and timestamp into dir, which is created if needed. The modification
+// time of the files is set to the time of the snapshot.
+func (s *Snapshot) WriteDir(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, s.FileName(f))
+		if err := os.WriteFile(path, f.Data, 0666); err != nil {
+			return err
+		} else if err := os.Chtimes(path, s.Time, s.Time); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTar adds the files written by WriteDir to tw. It doesn't close tw, so
+// multiple snapshots can be written into the same archive.
+func (s *Snapshot) WriteTar(tw *tar.Writer) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    s.FileName(f),
+			Mode:    0666,
+			Size:    int64(len(f.Data)),
+			ModTime: s.Time,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		} else if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read returns the snapshots written into the directory or tar archive at
+// path by WriteDir or WriteTar, ordered by their sequence number. Files whose
+// name doesn't start with a sequence number, e.g. the incident.json written by
+// the collector, are ignored. Snapshots without a snapshot.json file, e.g.
+// from an older version, only have their Seq and Files set.
+func Read(path string) ([]*Snapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bySeq := map[int]*Snapshot{}
+	// order holds the names of the files listed in snapshot.json, which are
+	// in the order they were captured.
+	order := map[int][]string{}
+	add := func(name string, data []byte) error {
+		dot := strings.Index(name, ".")
+		if dot == -1 {
+			return nil
+		}
+		seq, err := strconv.Atoi(name[:dot])
+		if err != nil {
+			return nil
+		}
+		snap, ok := bySeq[seq]
+		if !ok {
+			snap = &Snapshot{Seq: seq}
+			bySeq[seq] = snap
+		}
+		if name[dot+1:] != metaName {
+			snap.Files = append(snap.Files, File{Name: name[dot+1:], Data: data})
+			return nil
+		}
+		var meta snapshotMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		snap.Time = meta.Time
+		snap.Duration = time.Duration(meta.DurationNs)
+		snap.Goroutines = meta.Goroutines
+		order[seq] = meta.Files
+		return nil
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(path, entry.Name()))
+			if err != nil {
+				return nil, err
+			} else if err := add(entry.Name(), data); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			} else if err := add(hdr.Name, data); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	if len(bySeq) == 0 {
+		return nil, fmt.Errorf("%s: no snapshots found", path)
+	}
+	snaps := make([]*Snapshot, 0, len(bySeq))
+	for _, snap := range bySeq {
+		if names := order[snap.Seq]; names != nil {
+			index := map[string]int{}
+			for i, name := range names {
+				index[name] = i
+			}
+			sort.SliceStable(snap.Files, func(i, j int) bool {
+				return index[snap.FileName(snap.Files[i])] < index[snap.FileName(snap.Files[j])]
+			})
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Seq < snaps[j].Seq })
+	return snaps, nil
+}
@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotter(t *testing.T) {
+	s := &Snapshotter{}
+	first, err := s.Take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Take()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Seq != 1 || second.Seq != 2 {
+		t.Errorf("seq: got %d and %d, want 1 and 2", first.Seq, second.Seq)
+	} else if second.Time.Before(first.Time) {
+		t.Errorf("time: %s is before %s", second.Time, first.Time)
+	} else if got, want := len(first.Files), len(Profiles); got != want {
+		t.Fatalf("files: got %d, want %d", got, want)
+	}
+	for _, f := range first.Files {
+		if len(f.Data) == 0 {
+			t.Errorf("%s: empty", f.Name)
+		}
+	}
+	if stack := first.Files[0].Data; !bytes.Contains(stack, []byte("TestSnapshotter")) {
+		t.Errorf("runtime.stack.txt doesn't contain the test goroutine:\n%s", stack)
+	}
+
+	dir := t.TempDir()
+	if err := second.WriteDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "2.snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta snapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	} else if meta.Seq != 2 || !meta.Time.Equal(second.Time) || len(meta.Files) != len(Profiles) {
+		t.Errorf("bad meta: %+v", meta)
+	}
+	info, err := os.Stat(filepath.Join(dir, "2.pprof.lookup.goroutine.debug2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	} else if info.ModTime().Unix() != second.Time.Unix() {
+		t.Errorf("mtime: got %s, want %s", info.ModTime(), second.Time)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, snap := range []*Snapshot{first, second} {
+		if err := snap.WriteTar(tw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := append([]byte(nil), buf.Bytes()...)
+	var names []string
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if got, want := len(names), 2*(len(Profiles)+1); got != want {
+		t.Errorf("tar entries: got %d, want %d: %s", got, want, strings.Join(names, ", "))
+	} else if got, want := names[len(Profiles)+1], "2.snapshot.json"; got != want {
+		t.Errorf("tar entry: got %q, want %q", got, want)
+	}
+
+	tarPath := filepath.Join(dir, "snapshots.tar")
+	if err := os.WriteFile(tarPath, archive, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir, tarPath} {
+		snaps, err := Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*Snapshot{second}
+		if path == tarPath {
+			want = []*Snapshot{first, second}
+		}
+		if len(snaps) != len(want) {
+			t.Fatalf("%s: got %d snapshots, want %d", path, len(snaps), len(want))
+		}
+		for i, snap := range snaps {
+			if snap.Seq != want[i].Seq || !snap.Time.Equal(want[i].Time) || snap.Goroutines != want[i].Goroutines {
+				t.Errorf("%s: snapshot %d: got seq=%d time=%s, want seq=%d time=%s", path, i, snap.Seq, snap.Time, want[i].Seq, want[i].Time)
+			} else if len(snap.Files) != len(want[i].Files) {
+				t.Errorf("%s: snapshot %d: got %d files, want %d", path, snap.Seq, len(snap.Files), len(want[i].Files))
+			} else if snap.Files[0].Name != want[i].Files[0].Name || !bytes.Equal(snap.Files[0].Data, want[i].Files[0].Data) {
+				t.Errorf("%s: snapshot %d: first file differs", path, snap.Seq)
+			}
+		}
+	}
+}